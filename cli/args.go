@@ -6,6 +6,9 @@ import (
 	"os"
 	"path"
 	"runtime"
+	"slices"
+	"strings"
+	"time"
 )
 
 // Args defines all command line arguments
@@ -14,8 +17,8 @@ type Args struct {
 	filePaths, filePathsShort                 *string
 	continueSession, continueSessionShort     *bool
 	listSessions, listSessionsShort           *bool
-	restoreSession, restoreSessionShort       *int
-	deleteSession, deleteSessionShort         *int
+	restoreSession, restoreSessionShort       *string
+	deleteSession, deleteSessionShort         *string
 	accessToken, accessTokenShort             *string
 	gcpProject, gcpProjectShort               *string
 	gcsBucket, gcsBucketShort                 *string
@@ -23,13 +26,37 @@ type Args struct {
 	executionEnabled, executionEnabledShort   *bool
 	executionApproval, executionApprovalShort *bool
 	debug, debugShort                         *bool
+	interactive, interactiveShort             *bool
+	Unredacted                                *bool
+	RedactPatterns                            *[]string
 	CustomURL                                 *string
 	CustomUploadURL                           *string
 	Version                                   *bool
 	DeleteAllSessions                         *bool
+	DeleteFiles                               *bool
+	FileRetention                             *time.Duration
 	DisableGrounding                          *bool
+	DisableUploadCache                        *bool
 	Stats                                     *bool
+	Stream                                    *bool
+	RetryAttempts                             *int
+	RetryDelay                                *time.Duration
+	RetryJitter                               *time.Duration
+	Timeout                                   *time.Duration
+	MaxFileSize                               *int64
+	InlineMaxSize                             *int64
+	UploadConcurrency                         *int
+	UploadChunkSize                           *int64
+	ContextBudget                             *int
+	HistoryOutputLimit                        *int
+	Proxy                                     *string
+	CACert                                    *string
 	AppDir                                    *string
+	SessionStore                              *string
+	Session                                   *string
+	SessionName                               *string
+	ExportFormat                              *string
+	ForkAt                                    *int
 	CustomModel                               *string
 	ProModel                                  *bool
 	MaxTokens                                 *int
@@ -37,22 +64,42 @@ type Args struct {
 	TopP                                      *float64
 	SystemPrompt                              *string
 	UseCase                                   *string
+	Profile                                   *string
+	Stdin                                     *bool
+	StdinAttach                               *bool
+	StdinMIMEType                             *string
+	sources                                   map[string]string
 }
 
-func ReadArgs(homeDir, app, proModel string) Args {
+// Commands lists the names of the commands that, when given as the first positional argument, are run in place of a prompt
+var Commands = []string{"config", "files", "search", "export", "import", "fork", "undo", "retry", "edit-last"}
+
+// requiredCommandArgs holds the number of arguments each command requires. where fewer follow the command name, it is taken as a prompt
+var requiredCommandArgs = map[string]int{"config": 1, "files": 1, "search": 1, "import": 1, "edit-last": 1}
+
+// ReadArgs parses the command line arguments, resolving any not explicitly specified from environment variables and
+// then the selected profile in the config file, in that order of precedence
+func ReadArgs(homeDir, app, proModel string) (Args, error) {
 	args := Args{}
 
 	args.Version = flag.Bool("version", false, "print the version")
 	args.quiet, args.quietShort = flagDef(flag.Bool, "quiet", "q", "quiet the output. supress activity indicators, such as spinners, to better support piping stdout into other utils when scripting", false)
-	args.filePaths, args.filePathsShort = flagDef(flag.String, "files", "f", "a comma separated list of files to attach to the prompt", "")
+	args.filePaths, args.filePathsShort = flagDef(flag.String, "files", "f", "a comma separated list of files, directories, glob patterns or remote http(s) and gs:// urls to attach to the prompt. "+
+		"directories are walked recursively and patterns may include '**' to match any number of directories. files excluded by a .gitignore or .genignore file, binary files and files exceeding --max-file-size are skipped. "+
+		"the detected mime type of a file can be overridden by suffixing it with :{mime-type}, such as data.bin:application/octet-stream", "")
 	args.continueSession, args.continueSessionShort = flagDef(flag.Bool, "continue", "c", "continue the active conversation rather than starting a new", false)
-	args.listSessions, args.listSessionsShort = flagDef(flag.Bool, "list", "l", "list all sessions by id", false)
-	args.restoreSession, args.restoreSessionShort = flagDef(flag.Int, "restore", "r", "the session id to restore", 0)
-	args.deleteSession, args.deleteSessionShort = flagDef(flag.Int, "delete", "d", "the session id to delete", 0)
+	args.interactive, args.interactiveShort = flagDef(flag.Bool, "interactive", "i", "start an interactive session in which prompts are read line by line, each continuing the active session. "+
+		"enter /help once started to list the available commands", false)
+	args.listSessions, args.listSessionsShort = flagDef(flag.Bool, "list", "l", "list all sessions with their index, id and name", false)
+	args.restoreSession, args.restoreSessionShort = flagDef(flag.String, "restore", "r", "the session to restore, specified by its id, name or index", "")
+	args.deleteSession, args.deleteSessionShort = flagDef(flag.String, "delete", "d", "the session to delete, specified by its id, name or index", "")
+	args.Session = flag.String("session", "", "the session to continue, specified by its id, name or index, rather than the active session. the active session is not changed")
+	args.SessionName = flag.String("name", "", "a name to give to the session the prompt is added to, by which it can then be restored, deleted or continued. where no prompt is specified, "+
+		"the active session, or that specified by --session, is named. names must start with a letter and contain only letters, digits, underscores and hyphens")
 
 	args.CustomURL = flag.String("url", "", "a custom url to use for the gemini api. by default the vertex-ai (gcp) or generative-language-api (ai-studio) canonical urls are used depending on whether "+
 		"an access-token is specified or not. where no access-token is specified, the generative-language-api form is used and the GEMINI_API_KEY envar is queried for the api-key to include in its querystring. where an "+
-		"access-token is specified, the vertex-ai form is used and both -gcp-project and -gcs-bucket arguments must be also specified. the following placeholders are supported in custom urls and will be populated "+
+		"access-token is specified, the vertex-ai form is used and the -gcp-project argument must be also specified. the following placeholders are supported in custom urls and will be populated "+
 		"where specified and appropriate: {model}, {api-key}, {gcp-project}")
 
 	args.CustomUploadURL = flag.String("upload-url", "", "a custom url to use for file uploads. by default the cloud storage (gcp) or generative-language-api (ai-studio) canonical urls are used depending on whether "+
@@ -66,7 +113,7 @@ func ReadArgs(homeDir, app, proModel string) Args {
 	args.gcpProject, args.gcpProjectShort = flagDef(flag.String, "gcp-project", "p", "the gcp project to include in the gemini api url. specifying a gcp-project will cause the vertex-ai (gcp) canonical endpoint to be "+
 		"used (unless a custom url is provided)", "")
 
-	args.gcsBucket, args.gcsBucketShort = flagDef(flag.String, "gcs-bucket", "b", "the cloud storage (gcp) bucket to upload files to when using the gemini api via a vertex-ai (gcp) endpoint. specifying a gcp-project "+
+	args.gcsBucket, args.gcsBucketShort = flagDef(flag.String, "gcs-bucket", "b", "the cloud storage (gcp) bucket to upload files to when using the gemini api via a vertex-ai (gcp) endpoint. it is only required to attach files larger than --inline-max-size. specifying a gcp-project "+
 		"will cause the vertex-ai (gcp) canonical endpoint to be used (unless a custom url is provided)", "")
 
 	args.executionEnabled, args.executionEnabledShort = flagDef(flag.Bool, "exec", "x", fmt.Sprintf("whether to enable command execution. when enabled prompts should relate to interacting with the local host environment "+
@@ -78,12 +125,38 @@ func ReadArgs(homeDir, app, proModel string) Args {
 		"as a json-form open-api schema. grounding with search must be disabled to use a schema", "")
 
 	args.DeleteAllSessions = flag.Bool("delete-all", false, "delete all session data")
+	args.DeleteFiles = flag.Bool("delete-files", false, "when deleting sessions with --delete or --delete-all, also delete the uploaded files they reference from file storage. files referenced by other sessions are retained")
+	args.FileRetention = flag.Duration("file-retention", 24*time.Hour, "the minimum age of uploaded files not referenced by any session that are removed by 'files prune'")
 	args.DisableGrounding = flag.Bool("no-grounding", false, "disable grounding with search")
+	args.DisableUploadCache = flag.Bool("no-upload-cache", false, "upload all attached files, rather than reusing earlier uploads of files whose content is unchanged")
 	args.debug, args.debugShort = flagDef(flag.Bool, "verbose", "v", "enable verbose output to support debugging", false)
+	args.Unredacted = flag.Bool("unredacted", false, "disable the redaction of credentials and other sensitive values from verbose output. intended only for local debugging, never use it where output may be captured, such as in ci pipelines")
+	args.RedactPatterns = &[]string{}
+	flag.Var((*stringList)(args.RedactPatterns), "redact", "a regular expression matching additional sensitive values to redact from verbose and error output. specify it multiple times to redact several patterns. "+
+		"where a pattern contains a capture group, the text matched by the first group is preserved. for example '(token=)[a-z0-9]+'")
 	args.Stats = flag.Bool("stats", false, "print count of tokens used")
+	args.Stream = flag.Bool("stream", false, "stream the response, writing text incrementally as it is generated rather than once it has completed")
 	args.AppDir = flag.String("app-dir", path.Join(homeDir, "."+app), fmt.Sprintf("location of the %v app directory", app))
+	args.SessionStore = flag.String("session-store", "file", "the type of store to hold sessions in. either 'file', which stores each session as a file in the app-dir, or 'sqlite', which stores them in a sqlite "+
+		"database in the app-dir")
+	args.ExportFormat = flag.String("format", "markdown", "the format to export a session in with 'export'. either 'markdown', 'html' or 'json'")
+	args.ForkAt = flag.Int("at", 0, "the number of turns, from the start of the session, to copy into the new session with 'fork'. a value of 0 copies all turns")
 	args.CustomModel = flag.String("model", "", "the specific model to use")
 	args.ProModel = flag.Bool("pro", false, fmt.Sprintf("use the thinking %v model", proModel))
+	args.RetryAttempts = flag.Int("retry-attempts", 3, "the maximum number of attempts to make for requests to the gemini and file storage apis that fail with a transient error, such as a 429 or 5xx status code")
+	args.RetryDelay = flag.Duration("retry-delay", time.Second, "the delay before the first retry of a failed request. the delay doubles with each subsequent retry, unless the api specifies a longer delay")
+	args.RetryJitter = flag.Duration("retry-jitter", 500*time.Millisecond, "the maximum random duration to add to each retry delay")
+	args.Timeout = flag.Duration("timeout", 10*time.Minute, "the maximum duration of any single request to the gemini or file storage apis, including reading the response. a value of 0 disables the timeout")
+	args.Proxy = flag.String("proxy", "", "the url of a proxy server to send requests to the gemini and file storage apis through. by default the HTTPS_PROXY, HTTP_PROXY and NO_PROXY envars are honoured")
+	args.CACert = flag.String("ca-cert", "", "the path to a pem encoded ca certificate bundle to trust in addition to the system certificates. for example, the certificate of a corporate proxy")
+	args.MaxFileSize = flag.Int64("max-file-size", 10*1024*1024, "the maximum size, in bytes, of a file found in a directory or by a glob pattern specified in --files, or fetched from a url. larger files found in directories or by patterns are skipped, while larger urls result in an error. a value of 0 disables the limit")
+	args.InlineMaxSize = flag.Int64("inline-max-size", 256*1024, "the maximum size, in bytes, of an attached file to include directly in the request rather than upload to file storage. a value of 0 causes all files to be uploaded")
+	args.UploadConcurrency = flag.Int("upload-concurrency", 4, "the maximum number of files to upload to file storage at the same time")
+	args.UploadChunkSize = flag.Int64("upload-chunk-size", 8*1024*1024, "the size, in bytes, of the chunks files are uploaded to file storage in. where sending a chunk fails, the upload resumes from the data the server received. the size is rounded up to a multiple of 262144 (256KB)")
+	args.ContextBudget = flag.Int("context-budget", 100000, "the estimated number of tokens of session history above which older turns are replaced by a summary generated by gemini, "+
+		"to limit the size and cost of requests in long sessions. the summarised turns are retained in the session. a value of 0 disables summarisation")
+	args.HistoryOutputLimit = flag.Int("history-output-limit", 16*1024, "the maximum number of bytes of the stdout and stderr of each command executed in an earlier turn to include in the session history "+
+		"sent with a prompt. longer output is truncated by removing its middle. a value of 0 disables truncation")
 	args.MaxTokens = flag.Int("max-tokens", 65536, "the maximum number of tokens to allow in a response")
 	args.Temperature = flag.Float64("temperature", 0, "the temperature setting for the model")
 	args.TopP = flag.Float64("top-p", 0, "the top-p setting for the model")
@@ -98,9 +171,41 @@ func ReadArgs(homeDir, app, proModel string) Args {
 	args.UseCase = flag.String("use-case", "", "free text information to include in the system prompt about the user or use-case, such as a role or location. "+
 		"for example 'you are running in a ci pipeline used to verify code quality' or 'you are assisting a go/linux software engineer based in staffordshire'")
 
+	args.Stdin = flag.Bool("stdin", false, "require data to be piped to stdin. piped data is appended to the prompt as a delimited block of text whether or not this is specified")
+	args.StdinAttach = flag.Bool("stdin-attach", false, "attach data piped to stdin as a file, rather than appending it to the prompt as a delimited block of text")
+	args.StdinMIMEType = flag.String("stdin-mime-type", "text/plain", "the mime type of data piped to stdin when it is attached as a file using --stdin-attach")
+	args.Profile = flag.String("profile", DefaultProfile, fmt.Sprintf("the named profile to read settings from in the %v file in the app-dir. settings specified by flags or envars take precedence over those in the profile", ConfigFileName))
+
 	flag.Parse()
 
-	return args
+	if err := resolveConfig(app, &args); err != nil {
+		return args, fmt.Errorf("unable to resolve configuration. %w", err)
+	}
+
+	return args, nil
+}
+
+// Command returns the command, and its arguments, specified by the positional arguments. if no command was specified an empty string is returned.
+// the first positional argument is only taken as a command where it is followed by the arguments the command requires and the positional
+// arguments are not preceded by '--', so a prompt of a single word that names a command, such as 'gen -- undo', is sent as a prompt
+func (args Args) Command() (string, []string) {
+	return command(os.Args[1:], flag.Args())
+}
+
+func command(arguments, positional []string) (string, []string) {
+	if len(positional) == 0 || !slices.Contains(Commands, positional[0]) {
+		return "", nil
+	}
+
+	if i := len(arguments) - len(positional) - 1; i >= 0 && arguments[i] == "--" { // '--' ends the flags, marking what follows as a prompt
+		return "", nil
+	}
+
+	if len(positional)-1 < requiredCommandArgs[positional[0]] {
+		return "", nil
+	}
+
+	return positional[0], positional[1:]
 }
 
 func (args Args) Quiet() bool {
@@ -115,15 +220,19 @@ func (args Args) ContinueSession() bool {
 	return readFlag("continue/c", args.continueSession, args.continueSessionShort)
 }
 
+func (args Args) Interactive() bool {
+	return readFlag("interactive/i", args.interactive, args.interactiveShort)
+}
+
 func (args Args) ListSessions() bool {
 	return readFlag("list/l", args.listSessions, args.listSessionsShort)
 }
 
-func (args Args) RestoreSession() int {
+func (args Args) RestoreSession() string {
 	return readFlag("restore/r", args.restoreSession, args.restoreSessionShort)
 }
 
-func (args Args) DeleteSession() int {
+func (args Args) DeleteSession() string {
 	return readFlag("delete/d", args.deleteSession, args.deleteSessionShort)
 }
 
@@ -155,11 +264,29 @@ func (args Args) Debug() bool {
 	return readFlag("verbose/v", args.debug, args.debugShort)
 }
 
+// stringList is a flag that may be specified multiple times, with each occurrence adding a value
+type stringList []string
+
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+
+	return strings.Join(*l, " ")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
 // flagDef is a helper function to define a flag and its shortform
 func flagDef[T any](flagFunc func(string, T, string) *T, name, shortform, desc string, val T) (*T, *T) {
 	f := flagFunc(name, val, desc)
 	fs := flagFunc(shortform, val, "shortform of -"+name)
 
+	shortforms[shortform] = name
+
 	return f, fs
 }
 
@@ -0,0 +1,33 @@
+package cli
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCommand(t *testing.T) {
+	tests := []struct {
+		name            string
+		arguments       []string
+		positional      []string
+		expectedCommand string
+		expectedArgs    []string
+	}{
+		{name: "prompt", arguments: []string{"-c", "summarise this"}, positional: []string{"summarise this"}},
+		{name: "command", arguments: []string{"undo"}, positional: []string{"undo"}, expectedCommand: "undo", expectedArgs: []string{}},
+		{name: "command with flags", arguments: []string{"--pro", "retry"}, positional: []string{"retry"}, expectedCommand: "retry", expectedArgs: []string{}},
+		{name: "command with arguments", arguments: []string{"search", "text"}, positional: []string{"search", "text"}, expectedCommand: "search", expectedArgs: []string{"text"}},
+		{name: "command name as prompt after terminator", arguments: []string{"-c", "--", "undo"}, positional: []string{"undo"}},
+		{name: "command name without required arguments", arguments: []string{"search"}, positional: []string{"search"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			command, args := command(tt.arguments, tt.positional)
+
+			if command != tt.expectedCommand || (tt.expectedArgs != nil && !slices.Equal(args, tt.expectedArgs)) {
+				t.Fatalf("expected command %q with arguments %v. got %q with %v", tt.expectedCommand, tt.expectedArgs, command, args)
+			}
+		})
+	}
+}
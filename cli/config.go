@@ -0,0 +1,188 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+const (
+	ConfigFileName      = "config.json"
+	UploadCacheFileName = "uploads.json"
+	DefaultProfile      = "default"
+)
+
+const (
+	sourceDefault = "default"
+	sourceFlag    = "flag"
+	sourceEnv     = "env"
+	sourceProfile = "profile"
+)
+
+type (
+	// ConfigFile defines the format of the config file held in the app directory. each profile maps the longform names of
+	// flags to the values to use for them when they are not otherwise specified by a flag or an environment variable
+	ConfigFile struct {
+		Profiles map[string]map[string]any `json:"profiles"`
+	}
+)
+
+var (
+	// shortforms maps the shortform name of each flag to its longform name
+	shortforms = map[string]string{}
+	// unprofiled lists the flags that cannot be set by a profile, as they are required to locate or select one, or identify a single session
+	unprofiled = []string{"app-dir", "profile", "session", "name"}
+)
+
+// envName returns the name of the environment variable that can be used to set the specified flag
+func envName(app, name string) string {
+	return strings.ToUpper(app + "_" + strings.ReplaceAll(name, "-", "_"))
+}
+
+// resolveConfig applies environment variables, and then the selected profile, to any flags not explicitly set on the command line.
+// it records the source of each flag value in the args
+func resolveConfig(app string, args *Args) error {
+	args.sources = map[string]string{}
+
+	flag.Visit(func(f *flag.Flag) {
+		args.sources[longform(f.Name)] = sourceFlag
+	})
+
+	var err error
+
+	flag.VisitAll(func(f *flag.Flag) {
+		if _, set := args.sources[f.Name]; set || isShortform(f.Name) || err != nil {
+			return
+		}
+
+		if v, ok := os.LookupEnv(envName(app, f.Name)); ok {
+			if setErr := f.Value.Set(v); setErr != nil {
+				err = fmt.Errorf("invalid value %q for environment variable %v. %w", v, envName(app, f.Name), setErr)
+				return
+			}
+
+			args.sources[f.Name] = sourceEnv
+		}
+	})
+
+	if err != nil {
+		return err
+	}
+
+	profile, err := readProfile(*args.AppDir, *args.Profile, args.sources["profile"] != "")
+
+	if err != nil {
+		return err
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(profile)) {
+		f := flag.Lookup(name)
+
+		switch {
+		case f == nil || isShortform(name):
+			return fmt.Errorf("unknown setting '%v' in profile '%v'", name, *args.Profile)
+		case slices.Contains(unprofiled, name):
+			return fmt.Errorf("setting '%v' in profile '%v' cannot be specified in a profile", name, *args.Profile)
+		case args.sources[name] != "":
+			continue
+		}
+
+		values, ok := profile[name].([]any) // a list sets a flag that may be specified multiple times, such as 'redact', once for each value
+
+		if !ok {
+			values = []any{profile[name]}
+		}
+
+		for _, v := range values {
+			if err := f.Value.Set(fmt.Sprint(v)); err != nil {
+				return fmt.Errorf("invalid value '%v' for setting '%v' in profile '%v'. %w", v, name, *args.Profile, err)
+			}
+		}
+
+		args.sources[name] = sourceProfile
+	}
+
+	return nil
+}
+
+// readProfile returns the settings in the named profile. a missing config file or profile is only an error where the profile was explicitly selected
+func readProfile(appDir, name string, selected bool) (map[string]any, error) {
+	data, err := os.ReadFile(path.Join(appDir, ConfigFileName))
+
+	if errors.Is(err, os.ErrNotExist) {
+		if selected {
+			return nil, fmt.Errorf("profile '%v' selected but no config file exists at '%v'", name, path.Join(appDir, ConfigFileName))
+		}
+
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file. %w", err)
+	}
+
+	configFile, decoder := ConfigFile{}, json.NewDecoder(bytes.NewReader(data))
+
+	decoder.UseNumber() // numbers are applied to flags as they are written, as large integers decoded as floats are formatted with an exponent
+
+	if err := decoder.Decode(&configFile); err != nil {
+		return nil, fmt.Errorf("unable to decode config file '%v'. %w", path.Join(appDir, ConfigFileName), err)
+	}
+
+	profile, ok := configFile.Profiles[name]
+
+	if !ok && selected {
+		return nil, fmt.Errorf("profile '%v' not found in config file '%v'", name, path.Join(appDir, ConfigFileName))
+	}
+
+	return profile, nil
+}
+
+// ShowConfig writes the effective value of each setting and the source it was resolved from
+func ShowConfig(args Args) {
+	flag.VisitAll(func(f *flag.Flag) {
+		if isShortform(f.Name) {
+			return
+		}
+
+		source := args.sources[f.Name]
+
+		if source == "" {
+			source = sourceDefault
+		}
+
+		value := f.Value.String()
+
+		for short, long := range shortforms { // where the shortform was used, its value is the effective one
+			if sf := flag.Lookup(short); long == f.Name && sf.Value.String() != sf.DefValue {
+				value = sf.Value.String()
+			}
+		}
+
+		if f.Name == "access-token" && value != "" {
+			value = "[REDACTED]"
+		}
+
+		Write("%v: %q [%v]", f.Name, value, source)
+	})
+}
+
+func isShortform(name string) bool {
+	_, ok := shortforms[name]
+	return ok
+}
+
+func longform(name string) string {
+	if l, ok := shortforms[name]; ok {
+		return l
+	}
+
+	return name
+}
@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"flag"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestResolveConfig(t *testing.T) {
+	appDir := t.TempDir()
+
+	config := `{"profiles": {"default": {"max-file-size": 20971520, "max-tokens": 100, "temperature": 0.5, "stream": true, "redact": ["(token=)[a-z]{1,3}", "internal"]}}}`
+
+	if err := os.WriteFile(path.Join(appDir, ConfigFileName), []byte(config), 0644); err != nil {
+		t.Fatalf("unable to write config file. %v", err)
+	}
+
+	t.Setenv("GEN_MAX_TOKENS", "200")
+
+	osArgs, commandLine := os.Args, flag.CommandLine
+	defer func() { os.Args, flag.CommandLine = osArgs, commandLine }()
+
+	os.Args = []string{"gen", "--app-dir", appDir, "--temperature", "0.9", "--redact", "a{1,3}", "--redact", "b"}
+	flag.CommandLine = flag.NewFlagSet("gen", flag.ContinueOnError)
+
+	args, err := ReadArgs(t.TempDir(), "gen", "test-pro-model")
+
+	if err != nil {
+		t.Fatalf("expected no error reading args. got %v", err)
+	}
+
+	tests := []struct {
+		name, source     string
+		actual, expected any
+	}{
+		{name: "max-file-size", source: sourceProfile, actual: *args.MaxFileSize, expected: int64(20971520)},
+		{name: "stream", source: sourceProfile, actual: *args.Stream, expected: true},
+		{name: "max-tokens", source: sourceEnv, actual: *args.MaxTokens, expected: 200},
+		{name: "temperature", source: sourceFlag, actual: *args.Temperature, expected: 0.9},
+		{name: "top-p", source: "", actual: *args.TopP, expected: 0.0},
+	}
+
+	for _, test := range tests {
+		if test.actual != test.expected || args.sources[test.name] != test.source {
+			t.Fatalf("expected '%v' to be %v from source %q. got %v from source %q", test.name, test.expected, test.source, test.actual, args.sources[test.name])
+		}
+	}
+
+	if patterns := *args.RedactPatterns; len(patterns) != 2 || patterns[0] != "a{1,3}" || patterns[1] != "b" {
+		t.Fatalf("expected each redact flag to add a pattern, taking precedence over the profile. got %q", patterns)
+	}
+}
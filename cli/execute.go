@@ -1,17 +1,19 @@
 package cli
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"fmt"
+	"os"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/comradequinn/gen/gemini"
 	"github.com/comradequinn/gen/log"
 )
 
-func execute(request gemini.ExecuteRequest, cfg gemini.Config, quiet bool) (gemini.ExecuteResult, error) {
+func execute(ctx context.Context, request gemini.ExecuteRequest, cfg gemini.Config, quiet bool) (gemini.ExecuteResult, error) {
 	result := gemini.ExecuteResult{
 		Executed: true,
 	}
@@ -31,9 +33,15 @@ func execute(request gemini.ExecuteRequest, cfg gemini.Config, quiet bool) (gemi
 		WriteInfo(request.Text + "\n")
 		Write("enter 'y' to approve the execution. enter any other value to deny: ")
 
-		input, _, _ := bufio.NewReader(Reader).ReadRune()
+		input, err := stdinLines().readLine(ctx) // stdin is shared with interactive mode, so is read through the one reader of its lines
 
-		if strings.ToLower(string(input)) != "y" {
+		if err != nil && ctx.Err() != nil {
+			log.DebugPrintf("command approval cancelled", "type", "cmd_approval_cancelled", "text", request.Text)
+			result.Code = 125
+			return result, nil
+		}
+
+		if strings.ToLower(strings.TrimSpace(input)) != "y" {
 			log.DebugPrintf("command execution declined by user", "type", "cmd_execution_declined", "text", request.Text)
 			result.Code = 125
 			return result, nil
@@ -41,7 +49,10 @@ func execute(request gemini.ExecuteRequest, cfg gemini.Config, quiet bool) (gemi
 		Write("")
 	}
 
-	cmd := exec.Command("bash", "-c", request.Text)
+	cmd := exec.CommandContext(ctx, "bash", "-c", request.Text)
+
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) } // allow the command to terminate gracefully...
+	cmd.WaitDelay = 5 * time.Second                                       // ...before it is forcibly killed
 
 	cmd.Stdout = &bytes.Buffer{}
 	cmd.Stderr = &bytes.Buffer{}
@@ -59,6 +70,11 @@ func execute(request gemini.ExecuteRequest, cfg gemini.Config, quiet bool) (gemi
 		}
 	}
 
+	if ctx.Err() != nil {
+		log.DebugPrintf("command execution cancelled", "type", "cmd_execution_cancelled", "text", request.Text)
+		result.Code = 125 // cancelled by the user
+	}
+
 	log.DebugPrintf("executed command locally", "type", "cmd_executed", "text", request.Text, "code", result.Code, "stdout", string(result.Stdout), "stderr", string(result.Stderr))
 
 	return result, nil
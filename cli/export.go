@@ -0,0 +1,246 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"regexp"
+	"strings"
+
+	"github.com/comradequinn/gen/gemini"
+	"github.com/comradequinn/gen/session"
+)
+
+// ExportFormats lists the formats sessions can be exported in
+var ExportFormats = []string{"markdown", "html", "json"}
+
+type (
+	// section is a titled part of a rendered transcript, such as a prompt or a response
+	section struct {
+		Title  string
+		Blocks []block
+	}
+	// block is an element of a section. any label is rendered first, followed by the text, as prose or as code, and then any items as a list
+	block struct {
+		Label string
+		Text  string
+		Code  bool
+		Items []string
+	}
+)
+
+var (
+	backticks    = regexp.MustCompile("`+")
+	htmlTemplate = template.Must(template.New("transcript").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; max-width: 50em; margin: 2em auto; line-height: 1.5; }
+section { border-top: 1px solid #ddd; padding: 0.5em 0; }
+pre { background: #f6f8fa; padding: 0.75em; overflow-x: auto; }
+.text { white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{range .Sections}}<section>
+<h2>{{.Title}}</h2>
+{{range .Blocks}}{{if .Label}}<p><strong>{{.Label}}</strong></p>
+{{end}}{{if .Code}}<pre><code>{{.Text}}</code></pre>
+{{else if .Text}}<p class="text">{{.Text}}</p>
+{{end}}{{if .Items}}<ul>
+{{range .Items}}<li><code>{{.}}</code></li>
+{{end}}</ul>
+{{end}}{{end}}</section>
+{{end}}</body>
+</html>
+`))
+)
+
+// Export writes the session identified by the reference, or the active session where the reference is empty, to stdout in the specified format
+func Export(store session.Store, ref, format string) error {
+	records, err := store.List()
+
+	if err != nil {
+		return fmt.Errorf("unable to list sessions. %w", err)
+	}
+
+	var record session.Record
+
+	for _, r := range records {
+		if r.Active {
+			record = r
+		}
+	}
+
+	if ref != "" {
+		if record, err = session.Find(records, ref); err != nil {
+			return err
+		}
+	}
+
+	if record.ID == "" {
+		return fmt.Errorf("no session is active. specify the session to export")
+	}
+
+	transactions, err := store.Read(record.ID)
+
+	if err != nil {
+		return fmt.Errorf("unable to read session. %w", err)
+	}
+
+	title := "session " + record.ID
+
+	if record.Name != "" {
+		title += " (" + record.Name + ")"
+	}
+
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(session.Transcript{ID: record.ID, Name: record.Name, Updated: record.TimeStamp, Transactions: transactions}, "", "  ")
+
+		if err != nil {
+			return fmt.Errorf("unable to encode session. %w", err)
+		}
+
+		WriteRaw("%s\n", data)
+	case "markdown":
+		WriteRaw("%v", markdown(title, transcriptSections(transactions)))
+	case "html":
+		html := strings.Builder{}
+
+		if err := htmlTemplate.Execute(&html, struct {
+			Title    string
+			Sections []section
+		}{Title: title, Sections: transcriptSections(transactions)}); err != nil {
+			return fmt.Errorf("unable to render session. %w", err)
+		}
+
+		WriteRaw("%v", html.String())
+	default:
+		return fmt.Errorf("unsupported export format '%v'. expected one of %v", format, strings.Join(ExportFormats, ", "))
+	}
+
+	return nil
+}
+
+// transcriptSections returns the sections that render the transactions as a readable transcript. summaries of earlier transactions
+// are omitted, as the transactions they summarise are rendered in full
+func transcriptSections(transactions []gemini.Transaction) []section {
+	sections := []section{}
+
+	for _, t := range transactions {
+		if t.Input.IsSummary() {
+			continue
+		}
+
+		labels := make([]string, 0, len(t.Input.FileReferences))
+
+		for _, f := range t.Input.FileReferences {
+			labels = append(labels, f.Label)
+		}
+
+		input := section{Title: "user"}
+
+		switch {
+		case t.Input.IsExecuteResult():
+			input.Title = "command result"
+			input.Blocks = append(input.Blocks, block{Label: fmt.Sprintf("exit code %v", t.Input.ExecuteResult.Code)})
+
+			if t.Input.ExecuteResult.Stdout != "" {
+				input.Blocks = append(input.Blocks, block{Label: "stdout", Text: t.Input.ExecuteResult.Stdout, Code: true})
+			}
+
+			if t.Input.ExecuteResult.Stderr != "" {
+				input.Blocks = append(input.Blocks, block{Label: "stderr", Text: t.Input.ExecuteResult.Stderr, Code: true})
+			}
+		case t.Input.IsReadResult() && t.Input.ReadResult.Error != "":
+			input.Title = "read result"
+			input.Blocks = append(input.Blocks, block{Text: "the files were not read. " + t.Input.ReadResult.Error})
+		case t.Input.IsReadResult():
+			input.Title = "read result"
+			input.Blocks = append(input.Blocks, block{Label: "files attached", Items: labels})
+		case t.Input.IsWriteResult() && t.Input.WriteResult.Error != "":
+			input.Title = "write result"
+			input.Blocks = append(input.Blocks, block{Text: "the files were not written. " + t.Input.WriteResult.Error})
+		case t.Input.IsWriteResult():
+			input.Title = "write result"
+			input.Blocks = append(input.Blocks, block{Text: "the files were written"})
+		case t.Input.Type == gemini.InputTypeFunction: // the function was cancelled before it returned a result
+			input.Title = "function result"
+			input.Blocks = append(input.Blocks, block{Text: "no result was returned"})
+		default:
+			input.Blocks = append(input.Blocks, block{Text: t.Input.Text})
+
+			if len(labels) > 0 {
+				input.Blocks = append(input.Blocks, block{Label: "files attached", Items: labels})
+			}
+		}
+
+		output := section{Title: "gemini"}
+
+		if t.Output.Text != "" {
+			output.Blocks = append(output.Blocks, block{Text: t.Output.Text})
+		}
+
+		if t.Output.IsExecuteRequest() {
+			output.Blocks = append(output.Blocks, block{Label: "execute command", Text: t.Output.ExecuteRequest.Text, Code: true})
+		}
+
+		if t.Output.IsReadRequest() {
+			output.Blocks = append(output.Blocks, block{Label: "read files", Items: t.Output.ReadRequest.FilePaths})
+		}
+
+		for _, f := range t.Output.WriteRequest.Files {
+			output.Blocks = append(output.Blocks, block{Label: "write file " + f.Name, Text: f.Data, Code: true})
+		}
+
+		sections = append(sections, input, output)
+	}
+
+	return sections
+}
+
+// markdown renders the sections as a markdown document
+func markdown(title string, sections []section) string {
+	md := strings.Builder{}
+
+	fmt.Fprintf(&md, "# %v\n", title)
+
+	for _, s := range sections {
+		fmt.Fprintf(&md, "\n## %v\n", s.Title)
+
+		for _, b := range s.Blocks {
+			if b.Label != "" {
+				fmt.Fprintf(&md, "\n**%v**\n", b.Label)
+			}
+
+			switch {
+			case b.Code:
+				fence := "```"
+
+				for _, run := range backticks.FindAllString(b.Text, -1) { // the fence must be longer than any run of backticks in the code
+					if len(run) >= len(fence) {
+						fence = strings.Repeat("`", len(run)+1)
+					}
+				}
+
+				fmt.Fprintf(&md, "\n%v\n%v\n%v\n", fence, strings.TrimSuffix(b.Text, "\n"), fence)
+			case b.Text != "":
+				fmt.Fprintf(&md, "\n%v\n", strings.TrimSpace(b.Text))
+			}
+
+			if len(b.Items) > 0 {
+				md.WriteString("\n")
+
+				for _, item := range b.Items {
+					fmt.Fprintf(&md, "- `%v`\n", item)
+				}
+			}
+		}
+	}
+
+	return md.String()
+}
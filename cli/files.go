@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/comradequinn/gen/gemini"
+	"github.com/comradequinn/gen/session"
+)
+
+// Files lists the files uploaded to file storage or, where the action is 'prune', deletes those not referenced by any session that are
+// older than the file retention period
+func Files(ctx context.Context, cfg gemini.Config, args Args, store session.Store, action string) error {
+	files, err := gemini.ListFiles(ctx, cfg)
+
+	if err != nil {
+		return err
+	}
+
+	referenced, err := store.FileURIs()
+
+	if err != nil {
+		return fmt.Errorf("unable to read sessions. %w", err)
+	}
+
+	slices.SortFunc(files, func(a, b gemini.UploadedFile) int { return a.Created.Compare(b.Created) })
+
+	if action == "list" {
+		for _, f := range files {
+			status := "orphaned"
+
+			if slices.Contains(referenced, f.URI) {
+				status = "referenced"
+			}
+
+			Write("%v (%v) [%v]: %v", f.Name, f.Created.Format("January 02 2006 15:04"), status, f.URI)
+		}
+
+		return nil
+	}
+
+	pruned := []string{}
+
+	for _, f := range files {
+		if slices.Contains(referenced, f.URI) || time.Since(f.Created) < *args.FileRetention {
+			continue
+		}
+
+		WriteInfo("removing %v (%v)", f.Name, f.Created.Format("January 02 2006 15:04"))
+		pruned = append(pruned, f.URI)
+	}
+
+	if err := gemini.DeleteFiles(ctx, cfg, pruned); err != nil {
+		return err
+	}
+
+	WriteInfo("removed %v of %v uploaded file(s)", len(pruned), len(files))
+
+	return nil
+}
@@ -1,9 +1,12 @@
 package cli
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/comradequinn/gen/gemini"
@@ -11,27 +14,159 @@ import (
 	"github.com/comradequinn/gen/session"
 )
 
-func Generate(cfg gemini.Config, args Args, quiet bool, promptText, schema string, filePaths []string) {
-	var err error
+// Generate sends the prompt to gemini, performing any function calls it requests, until a final response is received and written to stdout.
+// if the context is cancelled, in-flight work is abandoned, any outstanding function call is recorded as cancelled in the session and the
+// process exits with code 130. any other error terminates the process
+func Generate(ctx context.Context, cfg gemini.Config, args Args, store session.Store, quiet bool, promptText, schema string, filePaths []string, attachments []gemini.Attachment) {
+	exit(converse(ctx, cfg, args, store, quiet, promptText, schema, filePaths, attachments, nil, false), quiet)
+}
+
+// Retry resends the last user prompt of the session, along with the files attached to it, replacing the last turn with the response. where
+// prompt text is specified, it is sent in place of the last user prompt. the last turn is only removed once a response has been received, so
+// it remains in the session should the retry fail or be cancelled. errors and cancellation are handled as for Generate
+func Retry(ctx context.Context, cfg gemini.Config, args Args, store session.Store, quiet bool, promptText, schema string, filePaths []string, attachments []gemini.Attachment) {
+	history, err := store.Read(*args.Session)
+	log.FatalfIf(err != nil, "unable to read session. %v", err)
+
+	last := session.LastTurn(history)
+	log.FatalfIf(last < 0, "the session has no turns to retry")
+
+	if promptText == "" {
+		promptText = history[last].Input.Text
+	}
+
+	exit(converse(ctx, cfg, args, store, quiet, promptText, schema, filePaths, attachments, history[last].Input.FileReferences, true), quiet)
+}
+
+// exit terminates the process where the conversational turn ended with an error, using exit code 130 where it was cancelled
+func exit(err error, quiet bool) {
+	if errors.Is(err, context.Canceled) {
+		if !quiet {
+			WriteInfo("cancelled")
+		}
+
+		os.Exit(130)
+	}
+
+	log.FatalfIf(err != nil, "%v", err)
+}
+
+// converse performs a single conversational turn. it sends the prompt to gemini, performing any function calls it requests, until a final
+// response is received and written to stdout. any file references are attached to the prompt alongside the files. where replace is set, the
+// prompt is sent in place of the last turn of the session, which is replaced once the response to it is received
+func converse(ctx context.Context, cfg gemini.Config, args Args, store session.Store, quiet bool, promptText, schema string, filePaths []string, attachments []gemini.Attachment, fileRefs []gemini.FileReference, replace bool) error {
+	streamed, ref, name := false, *args.Session, *args.SessionName
+
+	var request gemini.Output // the function call being responded to, if any
+
+	cancelled := func(prompt gemini.Prompt) error {
+		log.DebugPrintf("generation cancelled", "type", "generate_cancelled", "input_type", prompt.InputType)
+
+		if prompt.InputType == gemini.InputTypeFunction { // record the function result so the function call in the session is not left without a response
+			if err := store.Append(ref, gemini.Transaction{Input: cancelledResult(request, prompt)}); err != nil {
+				return fmt.Errorf("unable to record cancellation in session. %w", err)
+			}
+		}
+
+		return ctx.Err()
+	}
 
-	generate := func(prompt gemini.Prompt) gemini.Transaction {
-		stopSpinner := func() {}
+	generate := func(prompt gemini.Prompt) (gemini.Transaction, error) {
+		stopSpinner, spinnerStopped := func() {}, sync.Once{}
 		if !quiet {
 			stopSpinner = spin()
 		}
 
+		defer spinnerStopped.Do(stopSpinner)
+
+		cfg.UploadProgressFunc = nil
+
+		if !quiet && len(prompt.FilePaths) > 0 {
+			progressFunc, clearProgress := uploadProgress()
+			cfg.UploadProgressFunc = progressFunc
+			defer clearProgress()
+		}
+
+		streamed = false
+
+		if *args.Stream {
+			cfg.StreamFunc = func(text string) {
+				spinnerStopped.Do(stopSpinner)
+				streamed = true
+				WriteRaw("%v", text)
+			}
+		}
+
 		started := time.Now()
 
-		prompt.History, err = session.Read(*args.AppDir)
-		log.FatalfIf(err != nil, "unable to read history. %v", err)
+		var err error
+
+		if prompt.History, err = store.Read(ref); err != nil {
+			return gemini.Transaction{}, fmt.Errorf("unable to read history. %w", err)
+		}
+
+		compact := gemini.Compact
 
-		transaction, err := gemini.Generate(cfg, prompt)
+		if replace { // the last turn is excluded from the history, as the prompt is sent in its place. the history is not compacted until it is replaced
+			prompt.History = prompt.History[:session.LastTurn(prompt.History)]
+			compact = func(context.Context, gemini.Config, []gemini.Transaction) (gemini.Transaction, bool, error) {
+				return gemini.Transaction{}, false, nil
+			}
+		}
+
+		summary, compacted, err := compact(ctx, cfg, prompt.History)
 
-		log.FatalfIf(err != nil, "error with gemini api. %v", err)
+		if err != nil && ctx.Err() != nil {
+			spinnerStopped.Do(stopSpinner)
+			return gemini.Transaction{}, cancelled(prompt)
+		}
 
-		log.FatalfIf(session.Write(*args.AppDir, transaction) != nil, "unable to update session. %v", err)
+		if err != nil {
+			return gemini.Transaction{}, fmt.Errorf("unable to compact history. %w", err)
+		}
 
-		stopSpinner()
+		if compacted { // the summary replaces the older turns in the history sent with this and later prompts
+			if err := store.Append(ref, summary); err != nil {
+				return gemini.Transaction{}, fmt.Errorf("unable to update session. %w", err)
+			}
+
+			prompt.History = append(prompt.History, summary)
+		}
+
+		transaction, err := gemini.Generate(ctx, cfg, prompt)
+
+		if err != nil && ctx.Err() != nil {
+			spinnerStopped.Do(stopSpinner)
+			return gemini.Transaction{}, cancelled(prompt)
+		}
+
+		if err != nil {
+			return gemini.Transaction{}, fmt.Errorf("error with gemini api. %w", err)
+		}
+
+		update := store.Append
+
+		if replace { // the last turn is replaced by the transaction in a single update, so it is never lost without being replaced
+			update, replace = store.Replace, false
+		}
+
+		if err := update(ref, transaction); err != nil {
+			return gemini.Transaction{}, fmt.Errorf("unable to update session. %w", err)
+		}
+
+		if name != "" { // name the session once it has been created by the first transaction
+			if err := store.Rename(ref, name); err != nil {
+				return gemini.Transaction{}, fmt.Errorf("unable to name session. %w", err)
+			}
+
+			name = ""
+		}
+
+		spinnerStopped.Do(stopSpinner)
+
+		if streamed && transaction.Output.IsFunction() { // terminate any text streamed ahead of a function call
+			Write("")
+		}
 
 		if *args.Stats {
 			enc := json.NewEncoder(os.Stderr)
@@ -43,6 +178,7 @@ func Generate(cfg gemini.Config, args Args, quiet bool, promptText, schema strin
 					"promptBytes":       fmt.Sprintf("%v", len(prompt.Text)),
 					"responseBytes":     fmt.Sprintf("%v", len(transaction.Output.Text)),
 					"tokens":            fmt.Sprintf("%v", transaction.Tokens),
+					"retries":           fmt.Sprintf("%v", transaction.Retries),
 					"filesStored":       fmt.Sprintf("%v", len(transaction.Input.FileReferences)),
 					"functionCall":      fmt.Sprintf("%v", transaction.Output.IsFunction()),
 					"secondsElapsed":    fmt.Sprintf("%v", time.Since(started).Seconds()),
@@ -50,27 +186,53 @@ func Generate(cfg gemini.Config, args Args, quiet bool, promptText, schema strin
 			})
 		}
 
-		return transaction
+		return transaction, nil
+	}
+
+	if len(filePaths) > 0 {
+		var (
+			size int64
+			err  error
+		)
+
+		if filePaths, size, err = gemini.ExpandFilePaths(cfg, filePaths); err != nil {
+			return fmt.Errorf("unable to resolve files. %w", err)
+		}
+
+		if !quiet {
+			previewFiles(filePaths, size)
+		}
 	}
 
 	prompt := gemini.Prompt{
-		Text:      promptText,
-		FilePaths: filePaths,
-		InputType: gemini.InputTypeUser,
-		Schema:    gemini.JSONSchema(schema),
+		Text:           promptText,
+		FilePaths:      filePaths,
+		Attachments:    attachments,
+		FileReferences: fileRefs,
+		InputType:      gemini.InputTypeUser,
+		Schema:         gemini.JSONSchema(schema),
 	}
 
-	transaction := generate(prompt)
+	transaction, err := generate(prompt)
+
+	if err != nil {
+		return err
+	}
 
 	for transaction.Output.IsFunction() {
 		prompt := gemini.Prompt{
 			InputType: gemini.InputTypeFunction,
 		}
 
+		request = transaction.Output
+
 		switch {
 		case transaction.Output.IsExecuteRequest():
-			if prompt.ExecuteResult, err = execute(transaction.Output.ExecuteRequest, cfg, quiet); err != nil {
-				log.FatalfIf(err != nil, "error executing command '%v' on behalf of gemini. %v", transaction.Output.ExecuteRequest.Text, err)
+			if prompt.ExecuteResult, err = execute(ctx, transaction.Output.ExecuteRequest, cfg, quiet); err != nil {
+				return fmt.Errorf("error executing command '%v' on behalf of gemini. %w", transaction.Output.ExecuteRequest.Text, err)
+			}
+			if ctx.Err() != nil {
+				return cancelled(prompt)
 			}
 			if prompt.ExecuteResult.Code != 0 && quiet {
 				log.DebugPrintf(fmt.Sprintf("terminating with non-zero exit code as quiet mode was enabled when a command executed on behalf of gemini signalled the exit code %v", prompt.ExecuteResult.Code))
@@ -79,13 +241,59 @@ func Generate(cfg gemini.Config, args Args, quiet bool, promptText, schema strin
 		case transaction.Output.IsReadRequest():
 			prompt.FilePaths, prompt.ReadResult = readFiles(transaction.Output.ReadRequest, quiet)
 		case transaction.Output.IsWriteRequest():
-			if prompt.WriteResult, err = writeFiles(transaction.Output.WriteRequest, quiet); err != nil {
-				log.FatalfIf(err != nil, "error writing files on behalf of gemini. %v", err)
+			if prompt.WriteResult, err = writeFiles(ctx, transaction.Output.WriteRequest, quiet); err != nil && ctx.Err() == nil {
+				return fmt.Errorf("error writing files on behalf of gemini. %w", err)
 			}
 		}
 
-		transaction = generate(prompt)
+		if ctx.Err() != nil {
+			return cancelled(prompt)
+		}
+
+		if transaction, err = generate(prompt); err != nil {
+			return err
+		}
+	}
+
+	if streamed {
+		Write("")
+		return nil
 	}
 
 	Write("%v\n", transaction.Output.Text)
+
+	return nil
+}
+
+// cancelledResult returns the input that records the result of the function call where it was cancelled. a result the function completed
+// is retained, otherwise the result records the cancellation, so the function call always has a response when the session is replayed.
+// files requested by a read are only attached once the result is sent, so a cancelled read never attaches them
+func cancelledResult(request gemini.Output, prompt gemini.Prompt) gemini.Input {
+	const cancelledByUser = "cancelled by the user"
+
+	input := gemini.Input{Type: gemini.InputTypeFunction}
+
+	switch {
+	case request.IsExecuteRequest():
+		if input.ExecuteResult = prompt.ExecuteResult; !input.ExecuteResult.Executed {
+			input.ExecuteResult = gemini.ExecuteResult{Executed: true, Code: 125, Stderr: cancelledByUser}
+		}
+	case request.IsReadRequest():
+		input.ReadResult = gemini.ReadResult{Error: cancelledByUser}
+	case request.IsWriteRequest():
+		if input.WriteResult = prompt.WriteResult; !input.WriteResult.Written {
+			input.WriteResult = gemini.WriteResult{Error: cancelledByUser}
+		}
+	}
+
+	return input
+}
+
+// previewFiles lists the files that will be attached to the prompt along with their count and total size
+func previewFiles(filePaths []string, size int64) {
+	for _, f := range filePaths {
+		WriteInfo("+ %v", f)
+	}
+
+	WriteInfo("attaching %v file(s) totalling %v bytes", len(filePaths), size)
 }
@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/comradequinn/gen/gemini"
+	"github.com/comradequinn/gen/session"
+)
+
+// Import creates a new session from the transcript held in the file and sets it as the active session. the format of the transcript is
+// determined by the file extension. files referenced by a dialogue are read relative to the directory of the transcript and included inline
+func Import(store session.Store, file, name string) error {
+	var format string
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		format = session.TranscriptFormatJSON
+	case ".md", ".markdown":
+		format = session.TranscriptFormatMarkdown
+	case ".yaml", ".yml":
+		format = session.TranscriptFormatYAML
+	default:
+		return fmt.Errorf("unsupported transcript file '%v'. expected a .json, .md or .yaml file", file)
+	}
+
+	if name != "" {
+		if err := CheckSessionName(store, "", name, false); err != nil {
+			return err
+		}
+	}
+
+	data, err := os.ReadFile(file)
+
+	if err != nil {
+		return fmt.Errorf("unable to read transcript file. %w", err)
+	}
+
+	transactions, err := session.ParseTranscript(data, format, func(path string) (gemini.FileReference, error) {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(file), path)
+		}
+
+		return gemini.InlineFile(path)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err := store.Create(transactions, name); err != nil {
+		return fmt.Errorf("unable to create session. %w", err)
+	}
+
+	WriteInfo("imported %v transaction(s) into a new active session", len(transactions))
+
+	return nil
+}
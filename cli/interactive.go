@@ -0,0 +1,309 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/comradequinn/gen/gemini"
+	"github.com/comradequinn/gen/session"
+)
+
+const (
+	historyFileName  = "history"
+	historyListLimit = 20
+	multiLineMarker  = `"""`
+)
+
+// Interactive runs a read-eval-print loop in which each prompt entered continues the active session. lines starting with a '/' are treated
+// as commands that adjust the configuration of subsequent turns or manage sessions. an initial prompt and files, where specified, are sent
+// before the first prompt is read
+func Interactive(ctx context.Context, cfg gemini.Config, args Args, store session.Store, promptText, schema string, filePaths []string) {
+	var (
+		stdin   = stdinLines()
+		history = readHistory(*args.AppDir)
+	)
+
+	turn := func(promptText string) {
+		turnCtx, stop := signal.NotifyContext(ctx, os.Interrupt) // an interrupt cancels the current turn rather than terminating the process
+		defer stop()
+
+		err := converse(turnCtx, cfg, args, store, false, promptText, schema, filePaths, nil, nil, false)
+		filePaths = nil
+
+		if err == nil {
+			*args.SessionName = "" // the session is named by the first turn only
+		}
+
+		history = append(history, promptText)
+		appendHistory(*args.AppDir, promptText)
+
+		switch {
+		case errors.Is(err, context.Canceled):
+			WriteInfo("cancelled")
+		case err != nil:
+			WriteError("%v", err)
+		}
+	}
+
+	WriteInfo("interactive mode. enter /help to list commands. enter /exit or ctrl-d to quit")
+
+	if promptText != "" {
+		turn(promptText)
+	}
+
+	for {
+		input, err := readInput(stdin)
+
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				WriteError("unable to read input. %v", err)
+			}
+
+			Write("")
+			return
+		}
+
+		input = strings.TrimSpace(input)
+
+		if strings.HasPrefix(input, "!") { // recall an entry from history
+			if input, err = recallHistory(history, strings.TrimPrefix(input, "!")); err != nil {
+				WriteError("%v", err)
+				continue
+			}
+
+			WriteInfo("%v", input)
+		}
+
+		switch {
+		case input == "":
+			continue
+		case input == "/exit" || input == "/quit":
+			return
+		case strings.HasPrefix(input, "/"):
+			command, commandArgs, _ := strings.Cut(strings.TrimPrefix(input, "/"), " ")
+
+			if err := interactiveCommand(&cfg, args, store, history, &filePaths, command, strings.TrimSpace(commandArgs)); err != nil {
+				WriteError("%v", err)
+			}
+		default:
+			turn(input)
+		}
+	}
+}
+
+// interactiveCommand performs the specified slash command
+func interactiveCommand(cfg *gemini.Config, args Args, store session.Store, history []string, filePaths *[]string, command, commandArgs string) error {
+	toggle := func(current bool) (bool, error) {
+		switch commandArgs {
+		case "":
+			return !current, nil
+		case "on":
+			return true, nil
+		case "off":
+			return false, nil
+		default:
+			return current, fmt.Errorf("invalid argument '%v' for /%v. expected 'on' or 'off'", commandArgs, command)
+		}
+	}
+
+	var err error
+
+	switch command {
+	case "help":
+		Write("/files {file,...}   attach a comma separated list of files to the next prompt")
+		Write("/exec [on|off]      enable or disable command execution")
+		Write("/approve [on|off]   enable or disable approval of command execution")
+		Write("/pro [on|off]       switch between the pro and flash models")
+		Write("/stats [on|off]     enable or disable the reporting of usage statistics")
+		Write("/list               list all sessions")
+		Write("/restore {session}  restore the session with the specified id, name or index")
+		Write("/name {name}        name the current session")
+		Write("/new                stash the active session and start a new one")
+		Write("/history            list recent prompts. recall a prompt with !{n} or the last prompt with !!")
+		Write("/exit               quit interactive mode. ctrl-d can also be used")
+		Write(`end a line with \ to continue a prompt on the next line, or enter """ to start and end a multi-line prompt`)
+	case "files":
+		if commandArgs == "" {
+			return fmt.Errorf("no files specified. expected /files {file,...}")
+		}
+
+		*filePaths = nil
+
+		for _, f := range strings.Split(commandArgs, ",") {
+			*filePaths = append(*filePaths, strings.TrimSpace(f))
+		}
+
+		WriteInfo("%v file(s) will be attached to the next prompt", len(*filePaths))
+	case "exec":
+		if cfg.ExecutionEnabled, err = toggle(cfg.ExecutionEnabled); err != nil {
+			return err
+		}
+
+		WriteInfo("command execution enabled: %v", cfg.ExecutionEnabled)
+	case "approve":
+		if cfg.ExecutionApproval, err = toggle(cfg.ExecutionApproval); err != nil {
+			return err
+		}
+
+		WriteInfo("command execution approval enabled: %v", cfg.ExecutionApproval)
+	case "pro":
+		var pro bool
+
+		if pro, err = toggle(cfg.Model == gemini.Models.Pro); err != nil {
+			return err
+		}
+
+		cfg.Model = gemini.Models.Flash
+
+		if pro {
+			cfg.Model = gemini.Models.Pro
+		}
+
+		WriteInfo("model: %v", cfg.Model)
+	case "stats":
+		if *args.Stats, err = toggle(*args.Stats); err != nil {
+			return err
+		}
+
+		WriteInfo("stats enabled: %v", *args.Stats)
+	case "list":
+		records, err := store.List()
+
+		if err != nil {
+			return fmt.Errorf("unable to list sessions. %w", err)
+		}
+
+		ListSessions(records)
+	case "restore":
+		if commandArgs == "" {
+			return fmt.Errorf("no session specified. expected /restore {session}")
+		}
+
+		if err := store.Restore(commandArgs); err != nil {
+			return fmt.Errorf("unable to restore session. %w", err)
+		}
+
+		*args.Session = ""
+
+		WriteInfo("session %v restored", commandArgs)
+	case "name":
+		if err := store.Rename(*args.Session, commandArgs); err != nil {
+			return fmt.Errorf("unable to name session. %w", err)
+		}
+
+		WriteInfo("session named %v", commandArgs)
+	case "new":
+		if err := store.Stash(); err != nil {
+			return fmt.Errorf("unable to stash session. %w", err)
+		}
+
+		*args.Session = ""
+
+		WriteInfo("new session started")
+	case "history":
+		for i := max(0, len(history)-historyListLimit); i < len(history); i++ {
+			Write("%4v  %v", i+1, strings.ReplaceAll(history[i], "\n", " "))
+		}
+	default:
+		return fmt.Errorf("unknown command '/%v'. enter /help to list commands", command)
+	}
+
+	return nil
+}
+
+// readInput reads a prompt from the lines of input. a line ending in a backslash is joined with the next line, while a line consisting only
+// of the multi-line marker starts a block that continues until the marker is entered again
+func readInput(input *lineReader) (string, error) {
+	lines, block := []string{}, false
+
+	WriteRaw("> ")
+
+	for {
+		line, err := input.readLine(context.Background())
+
+		if err != nil && (line == "" || !errors.Is(err, io.EOF)) {
+			return "", err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case strings.TrimSpace(line) == multiLineMarker:
+			if block {
+				return strings.Join(lines, "\n"), nil
+			}
+
+			block = true
+		case block:
+			lines = append(lines, line)
+		case strings.HasSuffix(line, `\`):
+			lines = append(lines, strings.TrimSuffix(line, `\`))
+		default:
+			return strings.Join(append(lines, line), "\n"), nil
+		}
+
+		WriteRaw(". ")
+	}
+}
+
+// recallHistory returns the history entry identified by a 1-based index or, where the reference is '!', the most recent entry
+func recallHistory(history []string, ref string) (string, error) {
+	if len(history) == 0 {
+		return "", fmt.Errorf("no history available")
+	}
+
+	if ref == "!" {
+		return history[len(history)-1], nil
+	}
+
+	i, err := strconv.Atoi(ref)
+
+	if err != nil || i < 1 || i > len(history) {
+		return "", fmt.Errorf("invalid history reference '!%v'. expected a value between 1 and %v, or '!!'", ref, len(history))
+	}
+
+	return history[i-1], nil
+}
+
+// readHistory returns the prompts previously entered in interactive mode. each is stored as a json string on its own line, so
+// multi-line prompts are preserved
+func readHistory(appDir string) []string {
+	data, err := os.ReadFile(path.Join(appDir, historyFileName))
+
+	if err != nil {
+		return nil
+	}
+
+	history := []string{}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		entry := ""
+
+		if err := json.Unmarshal([]byte(line), &entry); err == nil && entry != "" {
+			history = append(history, entry)
+		}
+	}
+
+	return history
+}
+
+func appendHistory(appDir, entry string) {
+	f, err := os.OpenFile(path.Join(appDir, historyFileName), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+
+	if err != nil {
+		return // history is a convenience, so failing to record it is not an error
+	}
+
+	defer f.Close()
+
+	data, _ := json.Marshal(entry)
+	_, _ = f.Write(append(data, '\n'))
+}
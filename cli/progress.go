@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"sync"
+	"time"
+
+	"github.com/comradequinn/gen/gemini"
+)
+
+// progressInterval is the minimum interval between renders of upload progress, other than those made when an upload completes
+const progressInterval = 100 * time.Millisecond
+
+// uploadProgress returns a func that renders upload progress in place on the current line, leaving the first column free for the spinner,
+// and a func that clears the rendered progress
+func uploadProgress() (progressFunc gemini.UploadProgressFunc, clearFunc func()) {
+	var (
+		mu       sync.Mutex
+		rendered time.Time
+		files    int
+	)
+
+	progressFunc = func(p gemini.UploadProgress) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if p.Files == files && time.Since(rendered) < progressInterval {
+			return
+		}
+
+		rendered, files = time.Now(), p.Files
+
+		if p.Files == p.TotalFiles { // clear the progress once all uploads complete so it does not precede the response
+			WriteRaw("\r\x1b[K")
+			rendered = time.Time{}
+			return
+		}
+
+		WriteRaw("\r\x1b[K\x1b[90m  uploading [%v/%v files] [%v/%v bytes] current: %v (%v%%)\x1b[0m", p.Files, p.TotalFiles, p.Bytes, p.TotalBytes, p.File, percent(p.FileBytes, p.FileSize))
+	}
+
+	clearFunc = func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if !rendered.IsZero() {
+			WriteRaw("\r\x1b[K")
+			rendered = time.Time{}
+		}
+	}
+
+	return progressFunc, clearFunc
+}
+
+func percent(n, total int64) int64 {
+	if total <= 0 {
+		return 100
+	}
+
+	return n * 100 / total
+}
@@ -5,14 +5,31 @@ import (
 	"github.com/comradequinn/gen/log"
 )
 
+// readFiles returns the files requested by gemini that can be attached. paths that do not identify a single local file are not read and
+// the reasons are reported to gemini in the result
 func readFiles(request gemini.ReadRequest, quiet bool) ([]string, gemini.ReadResult) {
+	filePaths, result := []string{}, gemini.ReadResult{FilesAttached: true}
+
 	for _, f := range request.FilePaths {
+		if err := gemini.CheckReadPath(f); err != nil {
+			log.DebugPrintf("local file request rejected", "type", "file_request_rejected", "file", f, "err", err)
+
+			if !quiet {
+				WriteInfo("not reading '%v'. %v", f, err)
+			}
+
+			result.Rejected = append(result.Rejected, err.Error())
+			continue
+		}
+
 		log.DebugPrintf("local file requested", "type", "file_request", "file", f)
 
 		if !quiet {
 			WriteInfo("reading file '%v'...", f)
 		}
+
+		filePaths = append(filePaths, f)
 	}
 
-	return request.FilePaths, gemini.ReadResult{FilesAttached: true}
+	return filePaths, result
 }
@@ -7,15 +7,95 @@ import (
 	"github.com/comradequinn/gen/session"
 )
 
-// ListSessions displays the current and any saved sessions
+// ListSessions displays the current and any saved sessions. sessions forked from another session are displayed below it, indented, so the
+// sessions form a tree
 func ListSessions(records []session.Record) {
-	for i, r := range records {
+	children, listed := map[string][]session.Record{}, map[string]bool{}
+
+	for _, r := range records {
+		listed[r.ID] = true
+	}
+
+	for _, r := range records {
+		if r.Parent != "" && listed[r.Parent] {
+			children[r.Parent] = append(children[r.Parent], r)
+		}
+	}
+
+	var list func(r session.Record, depth int)
+
+	list = func(r session.Record, depth int) {
 		labelPrefix := "  "
 
 		if r.Active {
 			labelPrefix = "* "
 		}
 
-		Write(fmt.Sprintf("%v #%v (%v): %v\n", labelPrefix, i+1, r.TimeStamp.Format("January 02 2006"), strings.ToLower(r.Summary)))
+		if depth > 0 {
+			labelPrefix += strings.Repeat("   ", depth-1) + " └─"
+		}
+
+		label := r.ID
+
+		if r.Name != "" {
+			label += " " + r.Name
+		}
+
+		Write(fmt.Sprintf("%v #%v %v (%v): %v\n", labelPrefix, r.Index, label, r.TimeStamp.Format("January 02 2006"), strings.ToLower(r.Summary)))
+
+		for _, child := range children[r.ID] {
+			list(child, depth+1)
+		}
+	}
+
+	for _, r := range records {
+		if r.Parent == "" || !listed[r.Parent] {
+			list(r, 0)
+		}
+	}
+}
+
+// ResolveSession returns the id of the session identified by the reference, so the session remains identified if it is renamed
+func ResolveSession(store session.Store, ref string) (string, error) {
+	records, err := store.List()
+
+	if err != nil {
+		return "", fmt.Errorf("unable to list sessions. %w", err)
+	}
+
+	record, err := session.Find(records, ref)
+
+	if err != nil {
+		return "", err
+	}
+
+	return record.ID, nil
+}
+
+// CheckSessionName returns an error where the name cannot be given to the session with the specified id or, where the id is empty, to the
+// active session where it is continued, or otherwise a new session. it allows an invalid or duplicate name to be rejected before a prompt is sent
+func CheckSessionName(store session.Store, id, name string, continued bool) error {
+	if err := session.ValidateName(name); err != nil {
+		return err
+	}
+
+	records, err := store.List()
+
+	if err != nil {
+		return fmt.Errorf("unable to list sessions. %w", err)
+	}
+
+	for _, r := range records {
+		if r.Active && id == "" && continued {
+			id = r.ID
+		}
+	}
+
+	for _, r := range records {
+		if r.ID != id && (r.Name == name || r.ID == name) {
+			return fmt.Errorf("session name '%v' is already in use by session %v", name, r.ID)
+		}
 	}
+
+	return nil
 }
@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+type (
+	// lineReader reads lines from a reader in a single goroutine, one line ahead of its callers. as it is the only reader, a line is never
+	// lost to a read that is abandoned, such as a command approval cancelled while waiting for input, but is returned to the next caller
+	lineReader struct {
+		lines chan line
+	}
+	line struct {
+		text string
+		err  error
+	}
+)
+
+// stdinLines returns the reader of the lines of stdin shared by all that read input line by line, such as interactive prompts and command approvals
+var stdinLines = sync.OnceValue(func() *lineReader { return newLineReader(Reader) })
+
+func newLineReader(r io.Reader) *lineReader {
+	lr := &lineReader{lines: make(chan line)}
+
+	go func() {
+		reader := bufio.NewReader(r)
+
+		for {
+			text, err := reader.ReadString('\n')
+
+			if text != "" {
+				lr.lines <- line{text: text}
+			}
+
+			if err != nil {
+				for { // the error, such as io.EOF, is returned to every subsequent read
+					lr.lines <- line{err: err}
+				}
+			}
+		}
+	}()
+
+	return lr
+}
+
+// readLine returns the next line, including any line ending. where the context is cancelled before a line is read, its error is returned
+// and the line is held for the next read
+func (lr *lineReader) readLine(ctx context.Context) (string, error) {
+	select {
+	case l := <-lr.lines:
+		return l.text, l.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// ReadStdin returns the data piped or redirected to stdin. where stdin is a terminal, or otherwise not a pipe or regular file, it is not read
+// and false is returned; this avoids blocking on input that will never be closed, such as an interactive terminal or an unused ci runner stdin
+func ReadStdin() ([]byte, bool, error) {
+	piped, err := StdinPiped()
+
+	if err != nil || !piped {
+		return nil, false, err
+	}
+
+	data, err := io.ReadAll(Reader)
+
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to read stdin. %w", err)
+	}
+
+	return data, true, nil
+}
+
+// StdinPiped reports whether data is piped or redirected to stdin, without reading it
+func StdinPiped() (bool, error) {
+	fileInfo, err := os.Stdin.Stat()
+
+	if err != nil {
+		return false, fmt.Errorf("unable to stat stdin. %w", err)
+	}
+
+	return fileInfo.Mode()&os.ModeNamedPipe != 0 || fileInfo.Mode().IsRegular(), nil
+}
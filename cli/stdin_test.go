@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestLineReader(t *testing.T) {
+	r, w := io.Pipe()
+	lr := newLineReader(r)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := lr.readLine(ctx); !errors.Is(err, context.Canceled) { // a cancelled read, such as an abandoned approval, must not consume the next line
+		t.Fatalf("expected a cancelled read to return the context error. got %v", err)
+	}
+
+	go func() {
+		w.Write([]byte("y\nlast"))
+		w.Close()
+	}()
+
+	for _, expected := range []string{"y\n", "last"} {
+		if line, err := lr.readLine(context.Background()); err != nil || line != expected {
+			t.Fatalf("expected line %q. got %q, %v", expected, line, err)
+		}
+	}
+
+	if _, err := lr.readLine(context.Background()); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF once all lines are read. got %v", err)
+	}
+}
@@ -11,8 +11,8 @@ import (
 	"golang.org/x/sync/errgroup"
 )
 
-func writeFiles(request gemini.WriteRequest, quiet bool) (gemini.WriteResult, error) {
-	g, ctx := errgroup.WithContext(context.Background())
+func writeFiles(ctx context.Context, request gemini.WriteRequest, quiet bool) (gemini.WriteResult, error) {
+	g, ctx := errgroup.WithContext(ctx)
 
 	for _, f := range request.Files {
 		if !quiet {
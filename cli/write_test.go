@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/comradequinn/gen/gemini"
+	"github.com/comradequinn/gen/log"
+)
+
+func TestMain(m *testing.M) {
+	log.Init(false, func(string, ...any) {})
+	os.Exit(m.Run())
+}
+
+func TestWriteFilesCancelled(t *testing.T) {
+	request := gemini.Output{WriteRequest: gemini.WriteRequest{Files: []gemini.File{{Name: filepath.Join(t.TempDir(), "test-file.txt"), Data: "test-data"}}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := writeFiles(ctx, request.WriteRequest, true)
+	if err == nil {
+		t.Fatalf("expected an error writing files with a cancelled context. got none")
+	}
+
+	if _, err := os.Stat(request.WriteRequest.Files[0].Name); !os.IsNotExist(err) {
+		t.Fatalf("expected no file to be written with a cancelled context. got %v", err)
+	}
+
+	cancelledTransaction := gemini.Transaction{Input: cancelledResult(request, gemini.Prompt{InputType: gemini.InputTypeFunction, WriteResult: result})}
+
+	if !cancelledTransaction.Input.IsWriteResult() {
+		t.Fatalf("expected cancelled write to be recorded as a write result. got %+v", cancelledTransaction.Input)
+	}
+
+	var actualRq struct {
+		Contents []struct {
+			Role  string            `json:"role"`
+			Parts []json.RawMessage `json:"parts"`
+		} `json:"contents"`
+	}
+
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&actualRq); err != nil {
+			t.Fatalf("unable to decode gemini stub request body. %v", err)
+		}
+
+		w.Write([]byte(`{"candidates":[{"content":{"role":"model","parts":[{"text":"test-response"}]},"finishReason":"STOP"}]}`))
+	}))
+	defer svr.Close()
+
+	cfg := gemini.Config{
+		Credential: "test-api-key",
+		GeminiURL:  svr.URL + "/test-generate-url/",
+		MaxTokens:  1000,
+		HTTPClient: svr.Client(),
+	}
+
+	if _, err := gemini.Generate(context.Background(), cfg, gemini.Prompt{
+		Text:      "test prompt",
+		InputType: gemini.InputTypeUser,
+		History: []gemini.Transaction{
+			{Input: gemini.Input{Type: gemini.InputTypeUser, Text: "test-history"}, Output: request},
+			cancelledTransaction,
+		},
+	}); err != nil {
+		t.Fatalf("expected no error generating response. got %v", err)
+	}
+
+	if len(actualRq.Contents) != 4 {
+		t.Fatalf("expected 4 contents comprising the write call, its cancelled result and the prompt. got %v", len(actualRq.Contents))
+	}
+
+	for i, content := range actualRq.Contents {
+		if len(content.Parts) == 0 {
+			t.Fatalf("expected every content to have parts. content %v has none", i)
+		}
+	}
+
+	if response := string(actualRq.Contents[2].Parts[0]); !strings.Contains(response, "function_response") || !strings.Contains(response, "cancelled by the user") {
+		t.Fatalf("expected the cancelled write to be sent as a function response recording the cancellation. got %v", response)
+	}
+}
@@ -1,27 +1,70 @@
 package gemini
 
 import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"fmt"
+	"net/http"
+	"net/url"
+	"os"
 	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/comradequinn/gen/gemini/internal/resource"
+	"github.com/comradequinn/gen/gemini/internal/retry"
 )
 
 type (
 	Config struct {
-		GeminiURL         string
-		FileStorageURL    string
-		Credential        string
-		GCPProject        string
-		GCSBucket         string
-		Model             string
-		SystemPrompt      string
-		MaxTokens         int
-		Temperature       float64
-		TopP              float64
-		UseCase           string
-		Grounding         bool
-		ExecutionEnabled  bool
-		ExecutionApproval bool
+		GeminiURL          string
+		FileStorageURL     string
+		FileListURL        string // optional. the url used to list uploaded files, from which the urls used to delete them are also derived
+		Credential         string
+		GCPProject         string
+		GCSBucket          string
+		Model              string
+		SystemPrompt       string
+		MaxTokens          int
+		Temperature        float64
+		TopP               float64
+		UseCase            string
+		Grounding          bool
+		ExecutionEnabled   bool
+		ExecutionApproval  bool
+		StreamFunc         StreamFunc
+		RetryAttempts      int
+		RetryDelay         time.Duration
+		RetryJitter        time.Duration
+		HTTPClient         *http.Client // optional. when nil, a client is created from the http timeout, proxy and ca-cert settings
+		HTTPTimeout        time.Duration
+		HTTPProxy          string
+		HTTPCACert         string
+		MaxFileSize        int64
+		InlineMaxSize      int64  // files of this size or smaller are included inline in requests rather than uploaded. zero disables inlining
+		UploadCacheFile    string // optional. when specified, references to uploaded files are cached in the file and reused while the file content is unchanged
+		UploadConcurrency  int    // the maximum number of files to upload concurrently. values less than 1 are treated as 1
+		UploadProgressFunc UploadProgressFunc
+		UploadChunkSize    int64 // the size of the chunks files are uploaded in, rounded up to a multiple of 256KB. zero results in a default of 8MB
+		ContextBudget      int   // the estimated number of history tokens above which older turns are summarised by Compact. zero disables summarisation
+		HistoryOutputLimit int   // the number of bytes of stdout and stderr of commands executed in earlier turns to replay as history. zero disables truncation
+	}
+	// StreamFunc receives response text incrementally as it is generated when streaming is enabled
+	StreamFunc func(text string)
+	// UploadProgress describes the progress of the files being uploaded for a prompt at the point the progress of one of them changed
+	UploadProgress struct {
+		File       string
+		FileBytes  int64
+		FileSize   int64
+		Files      int // the number of files whose upload has completed
+		TotalFiles int
+		Bytes      int64
+		TotalBytes int64
 	}
+	// UploadProgressFunc receives upload progress. it is called concurrently from each upload so must be safe for concurrent use
+	UploadProgressFunc func(progress UploadProgress)
 )
 
 func (cfg Config) platform() Platform {
@@ -32,6 +75,94 @@ func (cfg Config) platform() Platform {
 	return PlatformGenerativeLanguage
 }
 
+// uploadCache returns the upload cache, or nil where caching is disabled. cached references are scoped to the platform and the storage
+// they were uploaded to, being the project of the api key or the gcs bucket, as they are not valid elsewhere
+func (cfg Config) uploadCache() *resource.Cache {
+	if cfg.UploadCacheFile == "" {
+		return nil
+	}
+
+	scope := "gcs:" + cfg.GCSBucket
+
+	if cfg.platform() == PlatformGenerativeLanguage {
+		hash := sha256.Sum256([]byte(cfg.Credential))
+		scope = "gla:" + hex.EncodeToString(hash[:8])
+	}
+
+	return resource.OpenCache(cfg.UploadCacheFile, scope)
+}
+
+// uploadProgressFunc adapts the upload progress func, where one is specified, to the form used by the resource package
+func (cfg Config) uploadProgressFunc() resource.ProgressFunc {
+	if cfg.UploadProgressFunc == nil {
+		return nil
+	}
+
+	return func(p resource.Progress) {
+		cfg.UploadProgressFunc(UploadProgress(p))
+	}
+}
+
+// endpoint returns the url of the generate endpoint and the authorisation header to present to it
+func (cfg Config) endpoint() (string, string) {
+	switch cfg.platform() {
+	case PlatformGenerativeLanguage:
+		return strings.ReplaceAll(cfg.GeminiURL, "{api-key}", cfg.Credential), ""
+	case PlatformVertex:
+		return cfg.GeminiURL, "Bearer " + cfg.Credential
+	default:
+		panic(fmt.Sprintf("unsupported api platform %v", cfg.platform()))
+	}
+}
+
+func (cfg Config) retryPolicy(retries *atomic.Int64) retry.Policy {
+	return retry.Policy{
+		MaxAttempts: cfg.RetryAttempts,
+		BaseDelay:   cfg.RetryDelay,
+		Jitter:      cfg.RetryJitter,
+		Retries:     retries,
+	}
+}
+
+func (cfg Config) httpClient() (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if cfg.HTTPProxy != "" {
+		proxyURL, err := url.Parse(cfg.HTTPProxy)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url '%v'. %w", cfg.HTTPProxy, err)
+		}
+
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if cfg.HTTPCACert != "" {
+		pem, err := os.ReadFile(cfg.HTTPCACert)
+
+		if err != nil {
+			return nil, fmt.Errorf("unable to read ca-cert file '%v'. %w", cfg.HTTPCACert, err)
+		}
+
+		certPool, err := x509.SystemCertPool()
+
+		if err != nil {
+			certPool = x509.NewCertPool()
+		}
+
+		if !certPool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid pem encoded certificates found in ca-cert file '%v'", cfg.HTTPCACert)
+		}
+
+		transport.TLSClientConfig = &tls.Config{RootCAs: certPool}
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   cfg.HTTPTimeout,
+	}, nil
+}
+
 func (cfg Config) withDefaults(prompt Prompt) (Config, error) {
 	if cfg.MaxTokens == 0 {
 		return cfg, fmt.Errorf("invalid configuration. maxtokens must be specified")
@@ -41,8 +172,16 @@ func (cfg Config) withDefaults(prompt Prompt) (Config, error) {
 		return cfg, fmt.Errorf("invalid prompt or configuration. a response schema cannot be specified when execution is enabled")
 	}
 
-	if (cfg.GCPProject != "" || cfg.GCSBucket != "") && (cfg.GCPProject == "" || cfg.GCSBucket == "") {
-		return cfg, fmt.Errorf("to use the gemini api via vertex-ai a gcp-project, gcs-bucket and vertex-access-token must be provided")
+	if cfg.GCSBucket != "" && cfg.GCPProject == "" {
+		return cfg, fmt.Errorf("to use the gemini api via vertex-ai a gcp-project and vertex-access-token must be provided. a gcs-bucket must also be provided to attach files that are not included inline")
+	}
+
+	if cfg.HTTPClient == nil {
+		var err error
+
+		if cfg.HTTPClient, err = cfg.httpClient(); err != nil {
+			return cfg, fmt.Errorf("invalid http configuration. %w", err)
+		}
 	}
 
 	if (prompt.Schema != "" || cfg.ExecutionEnabled) && cfg.Grounding {
@@ -53,16 +192,30 @@ func (cfg Config) withDefaults(prompt Prompt) (Config, error) {
 	case PlatformGenerativeLanguage:
 		if cfg.GeminiURL == "" {
 			cfg.GeminiURL = "https://generativelanguage.googleapis.com/v1beta/models/{model}:generateContent?key={api-key}"
+
+			if cfg.StreamFunc != nil {
+				cfg.GeminiURL = "https://generativelanguage.googleapis.com/v1beta/models/{model}:streamGenerateContent?alt=sse&key={api-key}"
+			}
 		}
 		if cfg.FileStorageURL == "" {
 			cfg.FileStorageURL = "https://generativelanguage.googleapis.com/upload/v1beta/files?key={api-key}"
 		}
+		if cfg.FileListURL == "" {
+			cfg.FileListURL = "https://generativelanguage.googleapis.com/v1beta/files?pageSize=100&key={api-key}"
+		}
 	case PlatformVertex:
 		if cfg.GeminiURL == "" {
 			cfg.GeminiURL = "https://aiplatform.googleapis.com/v1/projects/{gcp-project}/locations/global/publishers/google/models/{model}:generateContent"
+
+			if cfg.StreamFunc != nil {
+				cfg.GeminiURL = "https://aiplatform.googleapis.com/v1/projects/{gcp-project}/locations/global/publishers/google/models/{model}:streamGenerateContent?alt=sse"
+			}
 		}
 		if cfg.FileStorageURL == "" {
-			cfg.FileStorageURL = "https://storage.googleapis.com/upload/storage/v1/b/{gcs-bucket}/o?uploadType=media&name={file-name}"
+			cfg.FileStorageURL = "https://storage.googleapis.com/upload/storage/v1/b/{gcs-bucket}/o?uploadType=resumable&name={file-name}"
+		}
+		if cfg.FileListURL == "" {
+			cfg.FileListURL = "https://storage.googleapis.com/storage/v1/b/{gcs-bucket}/o"
 		}
 	}
 
@@ -73,7 +226,7 @@ func (cfg Config) withDefaults(prompt Prompt) (Config, error) {
 			"{gcs-bucket}", cfg.GCSBucket)
 	}
 
-	cfg.GeminiURL, cfg.FileStorageURL = formatURL(cfg.GeminiURL), formatURL(cfg.FileStorageURL)
+	cfg.GeminiURL, cfg.FileStorageURL, cfg.FileListURL = formatURL(cfg.GeminiURL), formatURL(cfg.FileStorageURL), formatURL(cfg.FileListURL)
 
 	cfg.SystemPrompt += fmt.Sprintf(". Your responses must not exceed %v words in length. ", float64(cfg.MaxTokens)*0.75)
 
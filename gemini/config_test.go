@@ -2,8 +2,11 @@ package gemini
 
 import (
 	"fmt"
+	"net/http"
+	"net/url"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestConfig_withdefaults(t *testing.T) {
@@ -52,7 +55,7 @@ func TestConfig_withdefaults(t *testing.T) {
 				if cfg.GeminiURL != expectedGeminiURL {
 					t.Errorf("expected geminiurl to be %s, got %s", expectedGeminiURL, cfg.GeminiURL)
 				}
-				expectedFileStorageURL := "https://storage.googleapis.com/upload/storage/v1/b/test-bucket/o?uploadType=media&name={file-name}"
+				expectedFileStorageURL := "https://storage.googleapis.com/upload/storage/v1/b/test-bucket/o?uploadType=resumable&name={file-name}"
 				if cfg.FileStorageURL != expectedFileStorageURL { // {file-name} is not replaced in withdefaults
 					t.Errorf("expected filestorageurl to be %s, got %s", expectedFileStorageURL, cfg.FileStorageURL)
 				}
@@ -84,15 +87,18 @@ func TestConfig_withdefaults(t *testing.T) {
 			wantErrMsg: "invalid prompt or configuration. a response schema cannot be specified when execution is enabled",
 		},
 		{
-			name: "invalid config - gcpproject without gcsbucket",
+			name: "valid config - gcpproject without gcsbucket",
 			cfg: Config{
 				MaxTokens:   100,
 				Temperature: 0.7,
 				GCPProject:  "test-project",
 			},
-			prompt:     basePrompt,
-			wantErr:    true,
-			wantErrMsg: "to use the gemini api via vertex-ai a gcp-project, gcs-bucket and vertex-access-token must be provided",
+			prompt: basePrompt,
+			validate: func(t *testing.T, cfg Config, originalCfg Config) {
+				if cfg.platform() != PlatformVertex {
+					t.Errorf("expected platform to be vertex, got %v", cfg.platform())
+				}
+			},
 		},
 		{
 			name: "invalid config - gcsbucket without gcpproject",
@@ -103,7 +109,7 @@ func TestConfig_withdefaults(t *testing.T) {
 			},
 			prompt:     basePrompt,
 			wantErr:    true,
-			wantErrMsg: "to use the gemini api via vertex-ai a gcp-project, gcs-bucket and vertex-access-token must be provided",
+			wantErrMsg: "to use the gemini api via vertex-ai a gcp-project and vertex-access-token must be provided. a gcs-bucket must also be provided to attach files that are not included inline",
 		},
 		{
 			name: "grounding disabled - with schema",
@@ -155,6 +161,47 @@ func TestConfig_withdefaults(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "custom http client retained",
+			cfg: Config{
+				MaxTokens:  100,
+				HTTPClient: &http.Client{Timeout: time.Second},
+			},
+			prompt: basePrompt,
+			validate: func(t *testing.T, cfg Config, originalCfg Config) {
+				if cfg.HTTPClient != originalCfg.HTTPClient {
+					t.Errorf("expected custom http client to be retained")
+				}
+			},
+		},
+		{
+			name: "http client created from settings",
+			cfg: Config{
+				MaxTokens:   100,
+				HTTPTimeout: time.Minute,
+				HTTPProxy:   "http://proxy.test:8080",
+			},
+			prompt: basePrompt,
+			validate: func(t *testing.T, cfg Config, originalCfg Config) {
+				if cfg.HTTPClient == nil || cfg.HTTPClient.Timeout != time.Minute {
+					t.Fatalf("expected http client with timeout of %v, got %+v", time.Minute, cfg.HTTPClient)
+				}
+				proxyURL, err := cfg.HTTPClient.Transport.(*http.Transport).Proxy(&http.Request{URL: &url.URL{Scheme: "https", Host: "generativelanguage.googleapis.com"}})
+				if err != nil || proxyURL.String() != "http://proxy.test:8080" {
+					t.Errorf("expected proxy url to be 'http://proxy.test:8080', got %v (error: %v)", proxyURL, err)
+				}
+			},
+		},
+		{
+			name: "invalid config - missing ca cert",
+			cfg: Config{
+				MaxTokens:  100,
+				HTTPCACert: "./missing-ca-cert.pem",
+			},
+			prompt:     basePrompt,
+			wantErr:    true,
+			wantErrMsg: "invalid http configuration. unable to read ca-cert file './missing-ca-cert.pem'. open ./missing-ca-cert.pem: no such file or directory",
+		},
 		{
 			name: "system prompt with use case",
 			cfg: Config{
@@ -0,0 +1,147 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/comradequinn/gen/gemini/internal/resource"
+	"github.com/comradequinn/gen/gemini/internal/resource/gcs"
+	"github.com/comradequinn/gen/gemini/internal/resource/gla"
+)
+
+type (
+	// UploadedFile describes a file uploaded to file storage by gen, being the files api or a gcs bucket depending on the platform
+	UploadedFile struct {
+		URI     string
+		Name    string
+		Created time.Time
+	}
+)
+
+// ListFiles returns the files uploaded to file storage by gen
+func ListFiles(ctx context.Context, cfg Config) ([]UploadedFile, error) {
+	cfg, listFunc, _, err := cfg.fileFuncs()
+
+	if err != nil {
+		return nil, err
+	}
+
+	objects, err := listFunc(ctx, cfg.fileRequest())
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to list uploaded files. %w", err)
+	}
+
+	files := make([]UploadedFile, 0, len(objects))
+
+	for _, o := range objects {
+		files = append(files, UploadedFile{URI: o.URI, Name: o.Name, Created: o.Created})
+	}
+
+	return files, nil
+}
+
+// DeleteFiles removes the uploaded files with the specified uris from file storage, and from the upload cache so they are not reused
+func DeleteFiles(ctx context.Context, cfg Config, uris []string) error {
+	cfg, _, deleteFunc, err := cfg.fileFuncs()
+
+	if err != nil {
+		return err
+	}
+
+	deleted := make([]string, 0, len(uris))
+
+	defer func() { // record deleted files in the cache even where a subsequent deletion fails
+		if cache := cfg.uploadCache(); cache != nil {
+			_ = cache.Remove(deleted...)
+		}
+	}()
+
+	for _, uri := range uris {
+		if err := deleteFunc(ctx, cfg.fileRequest(), uri); err != nil {
+			return fmt.Errorf("unable to delete uploaded file '%v'. %w", uri, err)
+		}
+
+		deleted = append(deleted, uri)
+	}
+
+	return nil
+}
+
+// fileFuncs returns the configuration, with defaults applied, and the functions used to manage uploaded files on the configured platform
+func (cfg Config) fileFuncs() (Config, resource.ListFunc, resource.DeleteFunc, error) {
+	cfg, err := cfg.withDefaults(Prompt{})
+
+	if err != nil {
+		return cfg, nil, nil, fmt.Errorf("invalid configuration. %w", err)
+	}
+
+	switch cfg.platform() {
+	case PlatformGenerativeLanguage:
+		return cfg, gla.List, gla.Delete, nil
+	case PlatformVertex:
+		if cfg.GCSBucket == "" {
+			return cfg, nil, nil, fmt.Errorf("a gcs-bucket must be specified to manage uploaded files via vertex-ai")
+		}
+
+		return cfg, gcs.List, gcs.Delete, nil
+	default:
+		panic(fmt.Sprintf("unsupported api platform %v", cfg.platform()))
+	}
+}
+
+func (cfg Config) fileRequest() resource.FileRequest {
+	return resource.FileRequest{
+		URL:        cfg.FileListURL,
+		Credential: cfg.Credential,
+		HTTPClient: cfg.HTTPClient,
+		Retry:      cfg.retryPolicy(&atomic.Int64{}),
+	}
+}
+
+// InlineFile returns a reference holding the data of the local file, for files attached to transactions not created by Generate, such as
+// those imported from a transcript. the file may be suffixed with ':{mime-type}' to override the detected type
+func InlineFile(file string) (FileReference, error) {
+	source, err := resource.FileSource(file)
+
+	if err != nil {
+		return FileReference{}, err
+	}
+
+	if source.Size > maxInlineRequestSize {
+		return FileReference{}, fmt.Errorf("file '%v' is %v bytes. files larger than %v bytes cannot be included inline", file, source.Size, maxInlineRequestSize)
+	}
+
+	ref, err := resource.Inline(source)
+
+	if err != nil {
+		return FileReference{}, err
+	}
+
+	return FileReference{MIMEType: ref.MIMEType, Label: ref.Label, Data: ref.Data}, nil
+}
+
+// CheckReadPath returns an error where a path requested by gemini in a read function call does not identify a single local file. remote
+// urls, gs:// uris, glob patterns and directories are rejected, so only paths specified by the user cause remote files to be fetched or
+// many files to be attached
+func CheckReadPath(p string) error {
+	if resource.IsRemote(p) {
+		return fmt.Errorf("'%v' is remote. only local files can be read", p)
+	}
+
+	fileInfo, err := resource.FileIO.Stat(p)
+
+	switch {
+	case err != nil && strings.ContainsAny(p, "*?["):
+		return fmt.Errorf("'%v' is a pattern. only individual files can be read", p)
+	case err != nil:
+		return fmt.Errorf("unable to read '%v'. %w", p, err)
+	case !fileInfo.Mode().IsRegular():
+		return fmt.Errorf("'%v' is not a file. only individual files can be read", p)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package gemini_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/comradequinn/gen/gemini"
+)
+
+func TestFiles(t *testing.T) {
+	created := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	deleted := []string{}
+
+	var svr *httptest.Server
+	svr = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("key") != "test-api-key" {
+			t.Fatalf("expected api key to be %v. got %v", "test-api-key", r.URL.Query().Get("key"))
+		}
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/files" && r.URL.Query().Get("pageToken") == "":
+			json.NewEncoder(w).Encode(map[string]any{
+				"files": []map[string]any{
+					{"uri": svr.URL + "/files/test-file-1", "displayName": "gen-attachment-a.txt", "createTime": created},
+					{"uri": svr.URL + "/files/test-file-2", "displayName": "other-tool-file.txt", "createTime": created},
+				},
+				"nextPageToken": "test-page-2",
+			})
+		case r.Method == http.MethodGet && r.URL.Path == "/files":
+			json.NewEncoder(w).Encode(map[string]any{
+				"files": []map[string]any{
+					{"uri": svr.URL + "/files/test-file-3", "displayName": "gen-attachment-b.txt", "createTime": created},
+				},
+			})
+		case r.Method == http.MethodDelete && r.URL.Path == "/files/test-file-1":
+			deleted = append(deleted, r.URL.Path)
+		case r.Method == http.MethodDelete && r.URL.Path == "/files/test-file-3":
+			deleted = append(deleted, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound) // expired files are treated as deleted
+		default:
+			t.Fatalf("unexpected %v request to %v", r.Method, r.URL.Path)
+		}
+	}))
+	defer svr.Close()
+
+	cfg := gemini.Config{
+		Credential:  "test-api-key",
+		FileListURL: svr.URL + "/files?key={api-key}",
+		MaxTokens:   1000,
+		HTTPClient:  svr.Client(),
+	}
+
+	files, err := gemini.ListFiles(context.Background(), cfg)
+
+	if err != nil {
+		t.Fatalf("expected no error listing files. got %v", err)
+	}
+
+	if len(files) != 2 || files[0].Name != "gen-attachment-a.txt" || files[1].Name != "gen-attachment-b.txt" || !files[0].Created.Equal(created) {
+		t.Fatalf("expected only files uploaded by gen to be listed across all pages. got %+v", files)
+	}
+
+	if err := gemini.DeleteFiles(context.Background(), cfg, []string{files[0].URI, files[1].URI}); err != nil {
+		t.Fatalf("expected no error deleting files. got %v", err)
+	}
+
+	if !slices.Equal(deleted, []string{"/files/test-file-1", "/files/test-file-3"}) {
+		t.Fatalf("expected both files to be deleted. got %v", deleted)
+	}
+}
+
+func TestCheckReadPath(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "[id].tsx")
+
+	if err := os.WriteFile(file, []byte("test-data"), 0644); err != nil {
+		t.Fatalf("unable to write test file. %v", err)
+	}
+
+	if err := gemini.CheckReadPath(file); err != nil {
+		t.Fatalf("expected a local file to be readable. got %v", err)
+	}
+
+	for _, p := range []string{"https://169.254.169.254/latest/meta-data", "gs://test-bucket/test-object", filepath.Join(dir, "*.tsx"), dir, filepath.Join(dir, "missing.txt")} {
+		if err := gemini.CheckReadPath(p); err == nil {
+			t.Fatalf("expected an error reading '%v'", p)
+		}
+	}
+}
@@ -13,7 +13,9 @@ type (
 		Stdout   string `json:"stdout"`
 	}
 	ReadResult struct {
-		FilesAttached bool `json:"filesAttached"`
+		FilesAttached bool     `json:"filesAttached"`
+		Rejected      []string `json:"rejected,omitempty"` // the reasons any requested paths were not read
+		Error         string   `json:"error,omitempty"`    // why no files were read, such as the read being cancelled
 	}
 	ExecuteRequest struct {
 		Text string `json:"text"`
@@ -29,7 +31,8 @@ type (
 		Data string `json:"data"`
 	}
 	WriteResult struct {
-		Written bool `json:"written"`
+		Written bool   `json:"written"`
+		Error   string `json:"error,omitempty"` // why the files were not written, such as the write being cancelled
 	}
 )
 
@@ -160,22 +163,38 @@ func (c ExecuteResult) marshalJSON() json.RawMessage {
 }
 
 func (r ReadResult) marshalJSON() json.RawMessage {
+	response := map[string]any{
+		"attached": r.FilesAttached,
+	}
+
+	if len(r.Rejected) > 0 {
+		response["rejected"] = r.Rejected
+	}
+
+	if r.Error != "" {
+		response["error"] = r.Error
+	}
+
 	j, _ := json.Marshal(map[string]any{
-		"name": (executeTool{}).ReadFunctionName(),
-		"response": map[string]any{
-			"attached": r.FilesAttached,
-		},
+		"name":     (executeTool{}).ReadFunctionName(),
+		"response": response,
 	})
 
 	return j
 }
 
 func (r WriteResult) marshalJSON() json.RawMessage {
+	response := map[string]any{
+		"written": r.Written,
+	}
+
+	if r.Error != "" {
+		response["error"] = r.Error
+	}
+
 	j, _ := json.Marshal(map[string]any{
-		"name": (executeTool{}).WriteFunctionName(),
-		"response": map[string]any{
-			"written": r.Written,
-		},
+		"name":     (executeTool{}).WriteFunctionName(),
+		"response": response,
 	})
 
 	return j
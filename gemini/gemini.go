@@ -3,9 +3,11 @@ package gemini
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
+	"sync/atomic"
 
 	"github.com/comradequinn/gen/gemini/internal/resource"
 	"github.com/comradequinn/gen/gemini/internal/resource/gcs"
@@ -29,9 +31,14 @@ var (
 	}
 )
 
+// maxInlineRequestSize is the maximum total size of the data included inline in a single request. the gemini api limits requests to 20MB,
+// so this allows for the remainder of the request and the growth caused by base64 encoding. inline data replayed from history counts towards it
+const maxInlineRequestSize = 12 * 1024 * 1024
+
 const (
 	InputTypeUser     = "user"
 	InputTypeFunction = "function"
+	InputTypeSummary  = "summary"
 )
 
 const (
@@ -39,36 +46,66 @@ const (
 	RoleModel = "model"
 )
 
+// ExpandFilePaths resolves directories and glob patterns in the file paths into the list of files that will be attached when they are
+// included in a prompt, along with the total size of the local files. files excluded by ignore rules, binary files of unsupported types and
+// files exceeding the maximum file size are omitted. remote urls are included as they are
+func ExpandFilePaths(cfg Config, filePaths []string) ([]string, int64, error) {
+	files, err := resource.Expand(filePaths, cfg.MaxFileSize)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var size int64
+
+	for _, f := range files {
+		if resource.IsRemote(f) { // the size of remote files is not known until they are fetched
+			continue
+		}
+
+		fileInfo, _, err := resource.FileInfo(f)
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		size += fileInfo.Size()
+	}
+
+	return files, size, nil
+}
+
 // Generate queries the Gemini API with the specified prompt and returns the result
-func Generate(cfg Config, prompt Prompt) (Transaction, error) {
+func Generate(ctx context.Context, cfg Config, prompt Prompt) (Transaction, error) {
 	var err error
 
 	if cfg, err = cfg.withDefaults(prompt); err != nil {
 		return Transaction{}, fmt.Errorf("invalid configuration. %w", err)
 	}
 
-	contents := addHistory(prompt.History)
+	history, _ := activeHistory(prompt.History) // transactions replaced by a summary are not replayed
+	contents, retries := addHistory(history, cfg.HistoryOutputLimit), &atomic.Int64{}
 
 	var (
-		part                schema.Part
-		resourceRefs        []resource.Reference
-		resourceUploadFunc  resource.UploadFunc
-		url                 string
-		authorisationHeader string
-		role                string
+		part               schema.Part
+		resourceRefs       []resource.Reference
+		resourceUploadFunc resource.UploadFunc
+		role               string
 	)
 
+	result := Input{ExecuteResult: prompt.ExecuteResult, ReadResult: prompt.ReadResult, WriteResult: prompt.WriteResult}
+
 	switch {
 	case prompt.InputType == InputTypeUser:
 		part = schema.Part{Text: prompt.Text}
 		role = RoleUser
-	case prompt.ExecuteResult.Executed:
+	case result.IsExecuteResult():
 		part = schema.Part{FunctionResponse: prompt.ExecuteResult.marshalJSON()}
 		role = RoleUser
-	case prompt.ReadResult.FilesAttached:
+	case result.IsReadResult():
 		part = schema.Part{FunctionResponse: prompt.ReadResult.marshalJSON()}
 		role = RoleUser
-	case prompt.WriteResult.Written:
+	case result.IsWriteResult():
 		part = schema.Part{FunctionResponse: prompt.WriteResult.marshalJSON()}
 		role = RoleUser
 	}
@@ -78,33 +115,122 @@ func Generate(cfg Config, prompt Prompt) (Transaction, error) {
 		Parts: []schema.Part{part},
 	}
 
+	url, authorisationHeader := cfg.endpoint()
+
 	switch cfg.platform() {
 	case PlatformGenerativeLanguage:
 		resourceUploadFunc = gla.Upload
-		url = strings.ReplaceAll(cfg.GeminiURL, "{api-key}", cfg.Credential)
 	case PlatformVertex:
 		resourceUploadFunc = gcs.Upload
-		url = cfg.GeminiURL
-		authorisationHeader = "Bearer " + cfg.Credential
-	default:
-		panic(fmt.Sprintf("unsupported api platform %v", cfg.platform()))
-	}
-
-	if len(prompt.FilePaths) > 0 {
-		if resourceRefs, err = resource.Upload(resource.BatchUploadRequest{
-			URL:        cfg.FileStorageURL,
-			Credential: cfg.Credential,
-			UploadFunc: resourceUploadFunc,
-			Files:      prompt.FilePaths,
-		}); err != nil {
-			return Transaction{}, err
+	}
+
+	if len(prompt.FilePaths) > 0 || len(prompt.Attachments) > 0 {
+		resourceRefs = make([]resource.Reference, len(prompt.FilePaths)+len(prompt.Attachments)) // held in the order the files were specified
+		sources, indexes := make([]resource.Source, 0, len(resourceRefs)), make([]int, 0, len(resourceRefs))
+
+		for i, f := range prompt.FilePaths {
+			var source resource.Source
+
+			switch {
+			case resource.IsGCSURI(f): // existing objects are referenced directly, rather than downloaded and uploaded again
+				if cfg.platform() != PlatformVertex {
+					return Transaction{}, fmt.Errorf("unable to attach '%v'. gs:// uris can only be attached when using the gemini api via vertex-ai", f)
+				}
+
+				ref, err := resource.GCSReference(f)
+
+				if err != nil {
+					return Transaction{}, err
+				}
+
+				resourceRefs[i] = ref
+				continue
+			case resource.IsURL(f):
+				source, err = resource.URLSource(ctx, resource.URLRequest{
+					URL:        f,
+					HTTPClient: cfg.HTTPClient,
+					Retry:      cfg.retryPolicy(retries),
+					MaxSize:    cfg.MaxFileSize,
+				})
+			default:
+				source, err = resource.FileSource(f)
+			}
+
+			if err != nil {
+				return Transaction{}, err
+			}
+
+			sources, indexes = append(sources, source), append(indexes, i)
+		}
+
+		for i, a := range prompt.Attachments {
+			source, err := resource.ReaderSource(a.Label, a.MIMEType, a.Reader)
+
+			if err != nil {
+				return Transaction{}, err
+			}
+
+			sources, indexes = append(sources, source), append(indexes, len(prompt.FilePaths)+i)
+		}
+
+		uploads, uploadIndexes, inlineTotal := []resource.Source{}, []int{}, inlineSize(contents) // inline data replayed from history counts towards the limit of the request
+
+		for _, f := range prompt.FileReferences {
+			inlineTotal += int64(len(f.Data))
+		}
+
+		for i, source := range sources { // small sources are included in the request directly, saving the round trips needed to upload them
+			if cfg.InlineMaxSize <= 0 || source.Size > cfg.InlineMaxSize || inlineTotal+source.Size > maxInlineRequestSize {
+				uploads, uploadIndexes = append(uploads, source), append(uploadIndexes, indexes[i])
+				continue
+			}
+
+			ref, err := resource.Inline(source)
+
+			if err != nil {
+				return Transaction{}, err
+			}
+
+			inlineTotal += source.Size
+			resourceRefs[indexes[i]] = ref
+		}
+
+		if len(uploads) > 0 {
+			if cfg.platform() == PlatformVertex && cfg.GCSBucket == "" {
+				return Transaction{}, fmt.Errorf("a gcs-bucket must be specified to attach files larger than %v bytes via vertex-ai. '%v' is %v bytes", cfg.InlineMaxSize, uploads[0].Label, uploads[0].Size)
+			}
+
+			uploadedRefs, err := resource.Upload(ctx, resource.BatchUploadRequest{
+				URL:          cfg.FileStorageURL,
+				Credential:   cfg.Credential,
+				HTTPClient:   cfg.HTTPClient,
+				UploadFunc:   resourceUploadFunc,
+				Retry:        cfg.retryPolicy(retries),
+				Cache:        cfg.uploadCache(),
+				Concurrency:  cfg.UploadConcurrency,
+				ProgressFunc: cfg.uploadProgressFunc(),
+				ChunkSize:    cfg.UploadChunkSize,
+				Sources:      uploads,
+			})
+
+			if err != nil {
+				return Transaction{}, err
+			}
+
+			for i, ref := range uploadedRefs { // uploaded references are returned in the order of the uploads
+				resourceRefs[uploadIndexes[i]] = ref
+			}
 		}
 
 		for _, ref := range resourceRefs {
-			content.Parts = append(content.Parts, schema.Part{File: &schema.FileData{URI: ref.URI, MIMEType: ref.MIMEType}})
+			content.Parts = append(content.Parts, FileReference{URI: ref.URI, MIMEType: ref.MIMEType, Data: ref.Data}.part())
 		}
 	}
 
+	for _, f := range prompt.FileReferences {
+		content.Parts = append(content.Parts, f.part())
+	}
+
 	contents = append(contents, content)
 
 	tools := []json.RawMessage{}
@@ -129,7 +255,7 @@ func Generate(cfg Config, prompt Prompt) (Transaction, error) {
 		generationConfig.ResponseSchema = json.RawMessage(prompt.Schema)
 	}
 
-	response, err := geminiHTTP(url, authorisationHeader, cfg, contents, tools, generationConfig)
+	response, err := geminiHTTP(ctx, url, authorisationHeader, cfg, cfg.retryPolicy(retries), contents, tools, generationConfig)
 
 	if err != nil {
 		return Transaction{}, err
@@ -162,18 +288,22 @@ func Generate(cfg Config, prompt Prompt) (Transaction, error) {
 
 	log.DebugPrintf("token count value reported", "type", "report", "token_count", response.UsageMetadata.TotalTokenCount)
 
-	filesReferences := make([]FileReference, 0, len(resourceRefs))
+	filesReferences := make([]FileReference, 0, len(resourceRefs)+len(prompt.FileReferences))
 
 	for _, resourceRef := range resourceRefs {
 		filesReferences = append(filesReferences, FileReference{
 			URI:      resourceRef.URI,
 			MIMEType: resourceRef.MIMEType,
 			Label:    resourceRef.Label,
+			Data:     resourceRef.Data,
 		})
 	}
 
+	filesReferences = append(filesReferences, prompt.FileReferences...)
+
 	transaction := Transaction{
-		Tokens: response.UsageMetadata.TotalTokenCount,
+		Tokens:  response.UsageMetadata.TotalTokenCount,
+		Retries: int(retries.Load()),
 		Input: Input{
 			Type:           prompt.InputType,
 			Text:           prompt.Text,
@@ -190,7 +320,7 @@ func Generate(cfg Config, prompt Prompt) (Transaction, error) {
 		},
 	}
 
-	if transaction.Output.IsFunction() {
+	if transaction.Output.IsFunction() && cfg.StreamFunc == nil { // streamed text has already been written, so it is kept to match what was shown
 		transaction.Output.Text = "" // discard any, typically inconsistent, output describing command execution, it can be derived from the function itself more consistently
 	}
 
@@ -1,17 +1,21 @@
 package gemini
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 
+	"github.com/comradequinn/gen/gemini/internal/retry"
 	"github.com/comradequinn/gen/gemini/internal/schema"
 	"github.com/comradequinn/gen/log"
 )
 
-func geminiHTTP(url, authorisationHeader string, cfg Config, contents []schema.Content, tools []json.RawMessage, generationConfig schema.GenerationConfig) (schema.Response, error) {
+func geminiHTTP(ctx context.Context, url, authorisationHeader string, cfg Config, retryPolicy retry.Policy, contents []schema.Content, tools []json.RawMessage, generationConfig schema.GenerationConfig) (schema.Response, error) {
 	request := bytes.Buffer{}
 	if err := json.NewEncoder(&request).Encode(schema.Request{
 		SystemInstruction: schema.SystemInstruction{
@@ -24,13 +28,15 @@ func geminiHTTP(url, authorisationHeader string, cfg Config, contents []schema.C
 		return schema.Response{}, fmt.Errorf("unable to encode gemini request as json. %w", err)
 	}
 
-	rq, _ := http.NewRequest(http.MethodPost, url, &request)
-	rq.Header.Set("Content-Type", "application/json")
-	rq.Header.Set("Authorization", authorisationHeader)
+	rs, err := retryPolicy.Do(ctx, "generate", func() (*http.Response, error) {
+		rq, _ := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(request.Bytes()))
+		rq.Header.Set("Content-Type", "application/json")
+		rq.Header.Set("Authorization", authorisationHeader)
 
-	log.DebugPrintf("sending generate request", "type", "generate_request", "url", url, "headers", rq.Header, "body", request.String())
+		log.DebugPrintf("sending generate request", "type", "generate_request", "url", url, "headers", rq.Header, "body", request.String())
 
-	rs, err := http.DefaultClient.Do(rq)
+		return cfg.HTTPClient.Do(rq)
+	})
 
 	if err != nil {
 		return schema.Response{}, fmt.Errorf("unable to send request to gemini api. %w", err)
@@ -38,6 +44,10 @@ func geminiHTTP(url, authorisationHeader string, cfg Config, contents []schema.C
 
 	defer rs.Body.Close()
 
+	if rs.StatusCode == http.StatusOK && strings.HasPrefix(rs.Header.Get("Content-Type"), "text/event-stream") {
+		return geminiSSE(rs, cfg.StreamFunc)
+	}
+
 	body, err := io.ReadAll(rs.Body)
 
 	if err != nil {
@@ -56,13 +66,110 @@ func geminiHTTP(url, authorisationHeader string, cfg Config, contents []schema.C
 		return schema.Response{}, fmt.Errorf("unable to parse response body or no valid response candidates returned. response: [%s]. error: %w", string(body), err)
 	}
 
+	if err := checkFinishReason(response); err != nil {
+		return schema.Response{}, err
+	}
+
+	if cfg.StreamFunc != nil { // a non-streaming endpoint was used with streaming enabled, so pass the complete text in one call
+		for _, part := range response.Candidates[0].Content.Parts {
+			if part.Text != "" {
+				cfg.StreamFunc(part.Text)
+			}
+		}
+	}
+
+	return response, nil
+}
+
+// geminiSSE decodes a server-sent-events response from the streamGenerateContent endpoint. the text of each chunk is passed to the
+// stream func as it arrives, while all chunks are merged into a single response equivalent to that of the generateContent endpoint
+func geminiSSE(rs *http.Response, streamFunc StreamFunc) (schema.Response, error) {
+	response, scanner, data := schema.Response{}, bufio.NewScanner(rs.Body), strings.Builder{}
+
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	merge := func() error {
+		if data.Len() == 0 {
+			return nil
+		}
+
+		defer data.Reset()
+
+		log.DebugPrintf("received generate response chunk", "type", "generate_response_chunk", "status", rs.Status, "chunk", data.String())
+
+		chunk := schema.Response{}
+
+		if err := json.Unmarshal([]byte(data.String()), &chunk); err != nil {
+			return fmt.Errorf("unable to parse response chunk. chunk: [%s]. error: %w", data.String(), err)
+		}
+
+		if chunk.UsageMetadata.TotalTokenCount > 0 {
+			response.UsageMetadata = chunk.UsageMetadata
+		}
+
+		if len(chunk.Candidates) == 0 {
+			return nil
+		}
+
+		if len(response.Candidates) == 0 {
+			response.Candidates = []schema.Candidate{{Content: schema.Content{Role: chunk.Candidates[0].Content.Role}}}
+		}
+
+		for _, part := range chunk.Candidates[0].Content.Parts {
+			if part.Text != "" && streamFunc != nil {
+				streamFunc(part.Text)
+			}
+
+			response.Candidates[0].Content.Parts = append(response.Candidates[0].Content.Parts, part)
+		}
+
+		if chunk.Candidates[0].FinishReason != "" {
+			response.Candidates[0].FinishReason = chunk.Candidates[0].FinishReason
+		}
+
+		return nil
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case line == "": // a blank line terminates an event
+			if err := merge(); err != nil {
+				return schema.Response{}, err
+			}
+		case strings.HasPrefix(line, "data:"):
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return schema.Response{}, fmt.Errorf("unable to read streamed response body. %w", err)
+	}
+
+	if err := merge(); err != nil { // process any final event not terminated by a blank line
+		return schema.Response{}, err
+	}
+
+	if len(response.Candidates) == 0 {
+		return schema.Response{}, fmt.Errorf("no valid response candidates returned in streamed response")
+	}
+
+	if err := checkFinishReason(response); err != nil {
+		return schema.Response{}, err
+	}
+
+	return response, nil
+}
+
+func checkFinishReason(response schema.Response) error {
 	switch response.Candidates[0].FinishReason {
 	case schema.FinishReasonStop:
 	case schema.FinishReasonMaxTokens:
-		return schema.Response{}, fmt.Errorf("the response was terminated before it completed as the maximum number of tokens was reached")
+		return fmt.Errorf("the response was terminated before it completed as the maximum number of tokens was reached")
 	default:
-		return schema.Response{}, fmt.Errorf("the response was terminated before it completed. the stated reason was '%v'", response.Candidates[0].FinishReason)
+		return fmt.Errorf("the response was terminated before it completed. the stated reason was '%v'", response.Candidates[0].FinishReason)
 	}
 
-	return response, nil
+	return nil
 }
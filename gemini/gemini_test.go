@@ -1,7 +1,9 @@
 package gemini_test
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -25,9 +27,12 @@ func (m MockFileInfo) ModTime() time.Time { return time.Time{} }
 func (m MockFileInfo) IsDir() bool        { return false }
 func (m MockFileInfo) Sys() any           { return nil }
 
-func TestGenerate(t *testing.T) {
+func TestMain(m *testing.M) {
 	log.Init(false, func(string, ...any) {})
+	os.Exit(m.Run())
+}
 
+func TestGenerate(t *testing.T) {
 	resource.FileIO.Stat = func(name string) (os.FileInfo, error) {
 		return MockFileInfo{
 			name: name,
@@ -128,6 +133,9 @@ func TestGenerate(t *testing.T) {
 		FilePaths: []string{
 			"test-file-1",
 		},
+		Attachments: []gemini.Attachment{
+			{Label: "stdin", MIMEType: "text/plain", Reader: strings.NewReader("test-stdin-data")},
+		},
 	}
 
 	assert := func(t *testing.T, condition bool, format string, v ...any) {
@@ -149,7 +157,7 @@ func TestGenerate(t *testing.T) {
 		}
 
 		if string(prompt.Schema) != "" {
-			assert(t, actualRq.GenerationConfig.ResponseMimeType == "application/json", "expected response mime type to be application/json when a response schema is specified. got %v")
+			assert(t, actualRq.GenerationConfig.ResponseMimeType == "application/json", "expected response mime type to be application/json when a response schema is specified. got %v", actualRq.GenerationConfig.ResponseMimeType)
 			data, _ := actualRq.GenerationConfig.ResponseSchema.MarshalJSON()
 			assert(t, string(data) == string(prompt.Schema), "expected response schema to be %v. got %v", prompt.Schema, string(data))
 		} else {
@@ -169,19 +177,319 @@ func TestGenerate(t *testing.T) {
 
 		assert(t, actualRq.Contents[2].Role == string(gemini.RoleUser), "expected role to be %v. got %v", gemini.RoleUser, actualRq.Contents[2].Role)
 		assert(t, actualRq.Contents[2].Parts[0].Text == prompt.Text, "expected text to be %v. got %v", prompt.Text, actualRq.Contents[2].Parts[0].Text)
+		assert(t, len(actualRq.Contents[2].Parts) == 3, "expected 3 parts for the text, file and attachment. got %v", len(actualRq.Contents[2].Parts))
 		assert(t, actualRq.Contents[2].Parts[1].File.URI == expectedFileURI, "expected file uri to be %v. got %v", expectedFileURI, actualRq.Contents[2].Parts[1].File.URI)
+		assert(t, actualRq.Contents[2].Parts[2].File.URI == expectedFileURI, "expected attachment uri to be %v. got %v", expectedFileURI, actualRq.Contents[2].Parts[2].File.URI)
 		assert(t, rs.Output.Text == expectedResponse.Candidates[0].Content.Parts[0].Text+expectedResponse.Candidates[0].Content.Parts[1].Text, "expected response text to be %v. got %v", expectedResponse.Candidates[0].Content.Parts[0].Text+expectedResponse.Candidates[0].Content.Parts[1].Text, rs.Output.Text)
 		assert(t, rs.Tokens == expectedResponse.UsageMetadata.TotalTokenCount, "expected response token count to be %v. got %v", expectedResponse.UsageMetadata.TotalTokenCount, rs.Tokens)
 	}
 
-	rs, err := gemini.Generate(cfg, prompt)
+	rs, err := gemini.Generate(context.Background(), cfg, prompt)
 
 	assertResponse(t, rs, err)
 
 	cfg.Grounding = false
 	prompt.Schema = `{"type":"object","properties":{"response":{"type":"string"}}}`
 
-	rs, err = gemini.Generate(cfg, prompt)
+	rs, err = gemini.Generate(context.Background(), cfg, prompt)
 
 	assertResponse(t, rs, err)
 }
+
+func TestGenerateStream(t *testing.T) {
+	chunks := []schema.Response{
+		{
+			Candidates: []schema.Candidate{{Content: schema.Content{Role: "model", Parts: []schema.Part{{Text: "test-chunk-a"}}}}},
+		},
+		{
+			Candidates: []schema.Candidate{{Content: schema.Content{Role: "model", Parts: []schema.Part{{Text: "test-chunk-b"}}}}},
+		},
+		{
+			Candidates:    []schema.Candidate{{Content: schema.Content{Role: "model", Parts: []schema.Part{{Text: "test-chunk-c"}}}, FinishReason: schema.FinishReasonStop}},
+			UsageMetadata: schema.UsageMetadata{TotalTokenCount: 500},
+		},
+	}
+
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("alt") != "sse" {
+			t.Fatalf("expected alt query parameter to be %v. got %v", "sse", r.URL.Query().Get("alt"))
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+
+		for _, chunk := range chunks {
+			data, _ := json.Marshal(chunk)
+			fmt.Fprintf(w, "data: %s\r\n\r\n", data)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer svr.Close()
+
+	streamed := []string{}
+
+	cfg := gemini.Config{
+		Credential:   "test-api-key",
+		GeminiURL:    svr.URL + "/test-stream-url/?alt=sse&api-key={api-key}",
+		SystemPrompt: "test-system-prompt",
+		MaxTokens:    1000,
+		HTTPClient:   svr.Client(),
+		StreamFunc:   func(text string) { streamed = append(streamed, text) },
+	}
+
+	rs, err := gemini.Generate(context.Background(), cfg, gemini.Prompt{Text: "test prompt", InputType: gemini.InputTypeUser})
+
+	if err != nil {
+		t.Fatalf("expected no error generating streamed response. got %v", err)
+	}
+
+	if len(streamed) != len(chunks) {
+		t.Fatalf("expected %v streamed text fragments. got %v", len(chunks), len(streamed))
+	}
+
+	for i, chunk := range chunks {
+		if streamed[i] != chunk.Candidates[0].Content.Parts[0].Text {
+			t.Fatalf("expected streamed text fragment %v to be %v. got %v", i, chunk.Candidates[0].Content.Parts[0].Text, streamed[i])
+		}
+	}
+
+	if rs.Output.Text != "test-chunk-atest-chunk-btest-chunk-c" {
+		t.Fatalf("expected response text to be %v. got %v", "test-chunk-atest-chunk-btest-chunk-c", rs.Output.Text)
+	}
+
+	if rs.Tokens != 500 {
+		t.Fatalf("expected response token count to be %v. got %v", 500, rs.Tokens)
+	}
+}
+
+func TestGenerateStreamFunctionCall(t *testing.T) {
+	chunks := []schema.Response{
+		{
+			Candidates: []schema.Candidate{{Content: schema.Content{Role: "model", Parts: []schema.Part{{Text: "test-preamble"}}}}},
+		},
+		{
+			Candidates: []schema.Candidate{{Content: schema.Content{Role: "model", Parts: []schema.Part{{FunctionCall: schema.FunctionCall{Name: "execute", Args: json.RawMessage(`{"text":"ls"}`)}}}}, FinishReason: schema.FinishReasonStop}},
+		},
+	}
+
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+
+		for _, chunk := range chunks {
+			data, _ := json.Marshal(chunk)
+			fmt.Fprintf(w, "data: %s\r\n\r\n", data)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer svr.Close()
+
+	streamed := strings.Builder{}
+
+	cfg := gemini.Config{
+		Credential: "test-api-key",
+		GeminiURL:  svr.URL + "/test-stream-url/?alt=sse&api-key={api-key}",
+		MaxTokens:  1000,
+		HTTPClient: svr.Client(),
+		StreamFunc: func(text string) { streamed.WriteString(text) },
+	}
+
+	rs, err := gemini.Generate(context.Background(), cfg, gemini.Prompt{Text: "test prompt", InputType: gemini.InputTypeUser})
+
+	if err != nil {
+		t.Fatalf("expected no error generating streamed response. got %v", err)
+	}
+
+	if !rs.Output.IsExecuteRequest() || rs.Output.ExecuteRequest.Text != "ls" {
+		t.Fatalf("expected an execute request for %v. got %+v", "ls", rs.Output)
+	}
+
+	if rs.Output.Text != streamed.String() {
+		t.Fatalf("expected the text streamed ahead of the function call to be kept in the response. expected %q. got %q", streamed.String(), rs.Output.Text)
+	}
+}
+
+func TestGenerateInline(t *testing.T) {
+	actualRq := schema.Request{}
+
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/test-generate-url/" {
+			t.Fatalf("expected no upload requests for inline data. got request to %v", r.URL.Path)
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&actualRq); err != nil {
+			t.Fatalf("unable to decode gemini stub request body. %v", err)
+		}
+
+		json.NewEncoder(w).Encode(schema.Response{
+			Candidates: []schema.Candidate{{Content: schema.Content{Role: "model", Parts: []schema.Part{{Text: "test-response"}}}, FinishReason: schema.FinishReasonStop}},
+		})
+	}))
+	defer svr.Close()
+
+	cfg := gemini.Config{
+		Credential:     "test-api-key",
+		GeminiURL:      svr.URL + "/test-generate-url/",
+		FileStorageURL: svr.URL + "/test-start-upload-url/",
+		MaxTokens:      1000,
+		HTTPClient:     svr.Client(),
+		InlineMaxSize:  1024,
+	}
+
+	rs, err := gemini.Generate(context.Background(), cfg, gemini.Prompt{
+		Text:      "test prompt",
+		InputType: gemini.InputTypeUser,
+		History: []gemini.Transaction{
+			{
+				Input: gemini.Input{
+					Type: gemini.InputTypeUser,
+					Text: "test-history-1",
+					FileReferences: []gemini.FileReference{
+						{URI: "test-file-ref-uri", MIMEType: "text/plain", Label: "uploaded"},
+						{MIMEType: "text/plain", Label: "inline", Data: []byte("test-history-data")},
+					},
+				},
+				Output: gemini.Output{Text: "test-history-2"},
+			},
+		},
+		Attachments: []gemini.Attachment{
+			{Label: "stdin", MIMEType: "text/plain", Reader: strings.NewReader("test-stdin-data")},
+		},
+	})
+
+	if err != nil {
+		t.Fatalf("expected no error generating response. got %v", err)
+	}
+
+	historyParts, promptParts := actualRq.Contents[0].Parts, actualRq.Contents[2].Parts
+
+	if len(historyParts) != 3 || historyParts[1].File == nil || historyParts[1].File.URI != "test-file-ref-uri" {
+		t.Fatalf("expected uploaded file in history to be referenced by uri. got %+v", historyParts)
+	}
+
+	if historyParts[2].InlineData == nil || string(historyParts[2].InlineData.Data) != "test-history-data" {
+		t.Fatalf("expected inline file in history to be included inline. got %+v", historyParts)
+	}
+
+	if len(promptParts) != 2 || promptParts[1].InlineData == nil || string(promptParts[1].InlineData.Data) != "test-stdin-data" || promptParts[1].InlineData.MIMEType != "text/plain" {
+		t.Fatalf("expected attachment to be included inline. got %+v", promptParts)
+	}
+
+	if len(rs.Input.FileReferences) != 1 || string(rs.Input.FileReferences[0].Data) != "test-stdin-data" {
+		t.Fatalf("expected inline attachment data to be recorded in the transaction. got %+v", rs.Input.FileReferences)
+	}
+}
+
+func TestGenerateInlineHistoryLimit(t *testing.T) {
+	actualRq := schema.Request{}
+
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&actualRq); err != nil {
+			t.Fatalf("unable to decode gemini stub request body. %v", err)
+		}
+
+		json.NewEncoder(w).Encode(schema.Response{
+			Candidates: []schema.Candidate{{Content: schema.Content{Role: "model", Parts: []schema.Part{{Text: "test-response"}}}, FinishReason: schema.FinishReasonStop}},
+		})
+	}))
+	defer svr.Close()
+
+	cfg := gemini.Config{
+		Credential:    "test-api-key",
+		GeminiURL:     svr.URL + "/test-generate-url/",
+		MaxTokens:     1000,
+		HTTPClient:    svr.Client(),
+		InlineMaxSize: 8 * 1024 * 1024,
+	}
+
+	history := []gemini.Transaction{}
+
+	for _, label := range []string{"older", "newer"} { // together, the inline files exceed the inline limit of a request
+		history = append(history, gemini.Transaction{
+			Input: gemini.Input{
+				Type:           gemini.InputTypeUser,
+				Text:           "test-history",
+				FileReferences: []gemini.FileReference{{MIMEType: "text/plain", Label: label, Data: []byte(strings.Repeat("x", 7*1024*1024))}},
+			},
+			Output: gemini.Output{Text: "test-history-response"},
+		})
+	}
+
+	if _, err := gemini.Generate(context.Background(), cfg, gemini.Prompt{Text: "test prompt", InputType: gemini.InputTypeUser, History: history}); err != nil {
+		t.Fatalf("expected no error generating response. got %v", err)
+	}
+
+	if older := actualRq.Contents[0].Parts; len(older) != 2 || older[1].InlineData != nil || !strings.Contains(older[1].Text, "'older'") {
+		t.Fatalf("expected the older inline file to be replaced by a note. got %+v", older)
+	}
+
+	if newer := actualRq.Contents[2].Parts; len(newer) != 2 || newer[1].InlineData == nil {
+		t.Fatalf("expected the newer inline file to be replayed. got %+v", newer)
+	}
+}
+
+func TestGenerateRemoteFiles(t *testing.T) {
+	actualRq := schema.Request{}
+
+	var svr *httptest.Server
+	svr = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/remote/data.csv":
+			w.Write([]byte("a,b\n1,2\n"))
+		case "/test-generate-url/":
+			if err := json.NewDecoder(r.Body).Decode(&actualRq); err != nil {
+				t.Fatalf("unable to decode gemini stub request body. %v", err)
+			}
+
+			json.NewEncoder(w).Encode(schema.Response{
+				Candidates: []schema.Candidate{{Content: schema.Content{Role: "model", Parts: []schema.Part{{Text: "test-response"}}}, FinishReason: schema.FinishReasonStop}},
+			})
+		default:
+			t.Fatalf("unexpected request to %v", r.URL.Path)
+		}
+	}))
+	defer svr.Close()
+
+	cfg := gemini.Config{
+		Credential:    "test-access-token",
+		GCPProject:    "test-project",
+		GeminiURL:     svr.URL + "/test-generate-url/",
+		MaxTokens:     1000,
+		HTTPClient:    svr.Client(),
+		InlineMaxSize: 1024,
+	}
+
+	prompt := gemini.Prompt{
+		Text:      "test prompt",
+		InputType: gemini.InputTypeUser,
+		FilePaths: []string{"gs://test-bucket/build/report.pdf", svr.URL + "/remote/data.csv"},
+	}
+
+	if _, err := gemini.Generate(context.Background(), cfg, prompt); err != nil {
+		t.Fatalf("expected no error generating response. got %v", err)
+	}
+
+	parts := actualRq.Contents[0].Parts
+
+	if len(parts) != 3 || parts[1].File == nil || parts[1].File.URI != "gs://test-bucket/build/report.pdf" || parts[1].File.MIMEType != "application/pdf" {
+		t.Fatalf("expected gs:// uri to be referenced directly. got %+v", parts)
+	}
+
+	if parts[2].InlineData == nil || string(parts[2].InlineData.Data) != "a,b\n1,2\n" || parts[2].InlineData.MIMEType != "text/csv" {
+		t.Fatalf("expected url to be fetched and included inline. got %+v", parts)
+	}
+
+	prompt.FilePaths = []string{prompt.FilePaths[1], prompt.FilePaths[0]}
+
+	if _, err := gemini.Generate(context.Background(), cfg, prompt); err != nil {
+		t.Fatalf("expected no error generating response. got %v", err)
+	}
+
+	if parts = actualRq.Contents[0].Parts; len(parts) != 3 || parts[1].InlineData == nil || parts[2].File == nil {
+		t.Fatalf("expected files to be attached in the order they were specified. got %+v", parts)
+	}
+
+	cfg.GCPProject = ""
+
+	if _, err := gemini.Generate(context.Background(), cfg, prompt); err == nil || !strings.Contains(err.Error(), "gs:// uris can only be attached") {
+		t.Fatalf("expected error attaching gs:// uri via the generative language api. got %v", err)
+	}
+}
@@ -1,18 +1,55 @@
 package gemini
 
-import "github.com/comradequinn/gen/gemini/internal/schema"
+import (
+	"context"
+	"fmt"
+	"strings"
 
-func addHistory(transactions []Transaction) []schema.Content {
+	"github.com/comradequinn/gen/gemini/internal/schema"
+	"github.com/comradequinn/gen/log"
+)
+
+const (
+	// summaryPrompt requests a summary of the conversation. it is recorded as the input of the summary transaction, so the summary is
+	// replayed as the response to it
+	summaryPrompt = "Summarise our conversation so far, so that it can replace the conversation as the context of further prompts. Include the questions asked, " +
+		"the answers and conclusions reached, the commands executed and their significant results, and any facts, names, values or preferences that may be referred to again. " +
+		"Respond only with the summary."
+	// charsPerToken is the approximate number of characters represented by a token, used to estimate the size of history without a request to the api
+	charsPerToken = 4
+	// fileTokens is the approximate number of tokens an attached file adds to a request. it is an estimate only, as the actual number depends on the type and size of the file
+	fileTokens = 258
+)
+
+// addHistory returns the contents that replay the transactions as history. the stdout and stderr of executed commands are truncated to the
+// output limit, where it is greater than zero. files included inline are replayed for the most recent transactions only, up to the maximum
+// inline size of a request, as they are sent again with every request. older inline files are replaced by a note that they were attached
+func addHistory(transactions []Transaction, outputLimit int) []schema.Content {
 	contents := make([]schema.Content, 0, len(transactions)+1)
+	replayInline, inlineSize := make([]bool, len(transactions)), int64(0)
+
+	for i := len(transactions) - 1; i >= 0; i-- {
+		size := int64(0)
+
+		for _, f := range transactions[i].Input.FileReferences {
+			size += int64(len(f.Data))
+		}
 
-	for _, transaction := range transactions {
+		if replayInline[i] = inlineSize+size <= maxInlineRequestSize; replayInline[i] {
+			inlineSize += size
+		}
+	}
+
+	for i, transaction := range transactions {
 		content := schema.Content{
 			Role: RoleUser,
 		}
 
 		switch {
 		case transaction.Input.IsExecuteResult():
-			content.Parts = append(content.Parts, schema.Part{FunctionResponse: transaction.Input.ExecuteResult.marshalJSON()})
+			result := transaction.Input.ExecuteResult
+			result.Stdout, result.Stderr = truncate(result.Stdout, outputLimit), truncate(result.Stderr, outputLimit)
+			content.Parts = append(content.Parts, schema.Part{FunctionResponse: result.marshalJSON()})
 		case transaction.Input.IsReadResult():
 			content.Parts = append(content.Parts, schema.Part{FunctionResponse: transaction.Input.ReadResult.marshalJSON()})
 		case transaction.Input.IsWriteResult():
@@ -24,14 +61,19 @@ func addHistory(transactions []Transaction) []schema.Content {
 
 			if len(transaction.Input.FileReferences) > 0 {
 				for _, fileReference := range transaction.Input.FileReferences {
-					content.Parts = append(content.Parts, schema.Part{
-						File: &schema.FileData{URI: fileReference.URI, MIMEType: fileReference.MIMEType},
-					})
+					if fileReference.URI == "" && !replayInline[i] {
+						content.Parts = append(content.Parts, schema.Part{Text: fmt.Sprintf("[the file '%v' was attached here, but is no longer included]", fileReference.Label)})
+						continue
+					}
+
+					content.Parts = append(content.Parts, fileReference.part())
 				}
 			}
 		}
 
-		contents = append(contents, content)
+		if len(content.Parts) > 0 { // the api rejects contents without parts
+			contents = append(contents, content)
+		}
 
 		content = schema.Content{
 			Role: RoleModel,
@@ -62,8 +104,171 @@ func addHistory(transactions []Transaction) []schema.Content {
 			}})
 		}
 
-		contents = append(contents, content)
+		if len(content.Parts) > 0 { // there is no output where a function call was cancelled before its result was sent
+			contents = append(contents, content)
+		}
 	}
 
 	return contents
 }
+
+// part returns the request part for the file, holding either its data inline or a reference to its uploaded form
+func (f FileReference) part() schema.Part {
+	if f.URI == "" {
+		return schema.Part{InlineData: &schema.Blob{MIMEType: f.MIMEType, Data: f.Data}}
+	}
+
+	return schema.Part{File: &schema.FileData{URI: f.URI, MIMEType: f.MIMEType}}
+}
+
+// inlineSize returns the total size of the data included inline in the contents
+func inlineSize(contents []schema.Content) int64 {
+	size := int64(0)
+
+	for _, content := range contents {
+		for _, part := range content.Parts {
+			if part.InlineData != nil {
+				size += int64(len(part.InlineData.Data))
+			}
+		}
+	}
+
+	return size
+}
+
+// activeHistory returns the transactions replayed as history, being the latest summary, where one exists, followed by the transactions
+// it does not replace. the index of each in the specified transactions is also returned
+func activeHistory(transactions []Transaction) ([]Transaction, []int) {
+	start, summary := 0, -1
+
+	for i, transaction := range transactions {
+		if transaction.Input.IsSummary() {
+			start, summary = transaction.Summarises, i
+		}
+	}
+
+	active, indexes := []Transaction{}, []int{}
+
+	if summary >= 0 {
+		active, indexes = append(active, transactions[summary]), append(indexes, summary)
+	}
+
+	for i := start; i < len(transactions); i++ {
+		if !transactions[i].Input.IsSummary() {
+			active, indexes = append(active, transactions[i]), append(indexes, i)
+		}
+	}
+
+	return active, indexes
+}
+
+// truncate shortens text longer than the limit by removing its middle, which is replaced by a marker stating the number of bytes removed.
+// the start and end of command output are typically the most significant, holding the command's initial output and its final result or error
+func truncate(text string, limit int) string {
+	if limit <= 0 || len(text) <= limit {
+		return text
+	}
+
+	head, tail := text[:limit/2], text[len(text)-limit/2:]
+
+	return head + fmt.Sprintf("\n... [%v bytes truncated] ...\n", len(text)-len(head)-len(tail)) + tail
+}
+
+// estimateTokens returns the approximate number of tokens of the contents
+func estimateTokens(contents []schema.Content) int {
+	chars, files := 0, 0
+
+	for _, content := range contents {
+		for _, part := range content.Parts {
+			if part.File != nil || part.InlineData != nil {
+				files++
+			}
+
+			chars += len(part.Text) + len(part.FunctionCall.Name) + len(part.FunctionCall.Args) + len(part.FunctionResponse)
+		}
+	}
+
+	return chars/charsPerToken + files*fileTokens
+}
+
+// Compact returns a transaction holding a summary, generated by gemini, of the older transactions in the history where the estimated
+// number of tokens in the history exceeds the context budget. once the transaction is appended to the history, the transactions it
+// summarises are no longer replayed, though they remain in the history. the most recent turns that fit within half the budget are not
+// summarised. false is returned where the history is within the budget, the budget is zero or there are no older turns to summarise.
+// where the summary cannot be generated, the failure is logged and false is returned, so the turn is sent with the uncompacted history;
+// an error is only returned where the context is cancelled or the configuration is invalid
+func Compact(ctx context.Context, cfg Config, history []Transaction) (Transaction, bool, error) {
+	if cfg.ContextBudget <= 0 {
+		return Transaction{}, false, nil
+	}
+
+	active, indexes := activeHistory(history)
+	tokens := estimateTokens(addHistory(active, cfg.HistoryOutputLimit))
+
+	if tokens <= cfg.ContextBudget {
+		return Transaction{}, false, nil
+	}
+
+	keep := -1
+
+	for i := len(active) - 1; i > 0; i-- { // find the earliest turn from which the remaining history fits in half the budget
+		if active[i].Input.Type == InputTypeFunction { // a function result cannot be separated from the function call that requested it
+			continue
+		}
+
+		if keep > 0 && estimateTokens(addHistory(active[i:], cfg.HistoryOutputLimit)) > cfg.ContextBudget/2 {
+			break
+		}
+
+		keep = i
+	}
+
+	if keep < 0 || (keep == 1 && active[0].Input.IsSummary()) { // summarising only the existing summary would not reduce the history
+		return Transaction{}, false, nil
+	}
+
+	log.DebugPrintf("compacting history", "type", "history_compacted", "estimated_tokens", tokens, "budget", cfg.ContextBudget, "summarised", indexes[keep])
+
+	cfg.StreamFunc = nil // the summary is not written to the output
+
+	var err error
+
+	if cfg, err = cfg.withDefaults(Prompt{}); err != nil {
+		return Transaction{}, false, fmt.Errorf("invalid configuration. %w", err)
+	}
+
+	url, authorisationHeader := cfg.endpoint()
+	contents := append(addHistory(active[:keep], cfg.HistoryOutputLimit), schema.Content{Role: RoleUser, Parts: []schema.Part{{Text: summaryPrompt}}})
+
+	response, err := geminiHTTP(ctx, url, authorisationHeader, cfg, cfg.retryPolicy(nil), contents, nil, schema.GenerationConfig{
+		MaxOutputTokens:  cfg.MaxTokens,
+		ResponseMimeType: "text/plain",
+	})
+
+	if err != nil && ctx.Err() != nil {
+		return Transaction{}, false, ctx.Err()
+	}
+
+	if err != nil {
+		log.DebugPrintf("unable to summarise history", "type", "history_compaction_failed", "err", err)
+		return Transaction{}, false, nil
+	}
+
+	summary := strings.Builder{}
+
+	for _, part := range response.Candidates[0].Content.Parts {
+		summary.WriteString(part.Text)
+	}
+
+	if summary.Len() == 0 {
+		log.DebugPrintf("unable to summarise history", "type", "history_compaction_failed", "err", "empty summary returned from gemini api")
+		return Transaction{}, false, nil
+	}
+
+	return Transaction{
+		Tokens:     response.UsageMetadata.TotalTokenCount,
+		Summarises: indexes[keep],
+		Input:      Input{Type: InputTypeSummary, Text: summaryPrompt},
+		Output:     Output{Text: summary.String()},
+	}, true, nil
+}
@@ -0,0 +1,155 @@
+package gemini_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/comradequinn/gen/gemini"
+	"github.com/comradequinn/gen/gemini/internal/schema"
+)
+
+func TestCompact(t *testing.T) {
+	requests := []schema.Request{}
+
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rq := schema.Request{}
+
+		if err := json.NewDecoder(r.Body).Decode(&rq); err != nil {
+			t.Fatalf("unable to decode gemini stub request body. %v", err)
+		}
+
+		requests = append(requests, rq)
+
+		_ = json.NewEncoder(w).Encode(schema.Response{
+			Candidates: []schema.Candidate{{
+				Content:      schema.Content{Role: gemini.RoleModel, Parts: []schema.Part{{Text: "test-summary"}}},
+				FinishReason: schema.FinishReasonStop,
+			}},
+		})
+	}))
+	defer svr.Close()
+
+	cfg := gemini.Config{
+		Credential:         "test-api-key",
+		GeminiURL:          svr.URL + "/test-generate-url/?key={api-key}",
+		MaxTokens:          1000,
+		ContextBudget:      1000,
+		HistoryOutputLimit: 100,
+	}
+
+	history := []gemini.Transaction{}
+
+	for i := range 6 { // each turn is estimated at 200 tokens, so the history exceeds the budget
+		history = append(history, gemini.Transaction{
+			Input:  gemini.Input{Type: gemini.InputTypeUser, Text: strings.Repeat(string(rune('a'+i)), 400)},
+			Output: gemini.Output{Text: strings.Repeat(string(rune('a'+i)), 400)},
+		})
+	}
+
+	summary, compacted, err := gemini.Compact(context.Background(), cfg, history)
+
+	if err != nil || !compacted {
+		t.Fatalf("expected history to be compacted. got %v, %v", compacted, err)
+	}
+
+	if summary.Summarises != 4 || summary.Output.Text != "test-summary" || !summary.Input.IsSummary() {
+		t.Fatalf("expected a summary of the turns not fitting in half the budget. got %+v", summary)
+	}
+
+	if contents := requests[0].Contents; len(contents) != 9 || contents[0].Parts[0].Text != history[0].Input.Text || len(requests[0].Tools) != 0 {
+		t.Fatalf("expected the summarised turns followed by the summary prompt to be sent without tools. got %+v", requests[0])
+	}
+
+	history = append(history, summary)
+
+	if _, compacted, err = gemini.Compact(context.Background(), cfg, history); err != nil || compacted {
+		t.Fatalf("expected compacted history to be within budget. got %v, %v", compacted, err)
+	}
+
+	history = append(history,
+		gemini.Transaction{
+			Input:  gemini.Input{Type: gemini.InputTypeUser, Text: "list the files"},
+			Output: gemini.Output{ExecuteRequest: gemini.ExecuteRequest{Text: "ls"}},
+		},
+		gemini.Transaction{
+			Input:  gemini.Input{Type: gemini.InputTypeFunction, ExecuteResult: gemini.ExecuteResult{Executed: true, Stdout: strings.Repeat("x", 10000)}},
+			Output: gemini.Output{Text: "there are many files"},
+		},
+	)
+
+	if _, err := gemini.Generate(context.Background(), cfg, gemini.Prompt{Text: "test prompt", InputType: gemini.InputTypeUser, History: history}); err != nil {
+		t.Fatalf("expected no error generating response. got %v", err)
+	}
+
+	contents := requests[len(requests)-1].Contents
+
+	if len(contents) != 11 || contents[1].Parts[0].Text != "test-summary" || contents[2].Parts[0].Text != history[4].Input.Text {
+		t.Fatalf("expected the summary to replace the summarised turns. got %+v", contents)
+	}
+
+	if response := string(contents[8].Parts[0].FunctionResponse); len(response) > 1000 || !strings.Contains(response, "bytes truncated") {
+		t.Fatalf("expected command output in history to be truncated. got %v", response)
+	}
+}
+
+func TestCompactSummaryOnly(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatalf("expected no request to summarise a history whose older turns are only the existing summary")
+	}))
+	defer svr.Close()
+
+	cfg := gemini.Config{
+		Credential:    "test-api-key",
+		GeminiURL:     svr.URL + "/test-generate-url/?key={api-key}",
+		MaxTokens:     1000,
+		ContextBudget: 100,
+	}
+
+	history := []gemini.Transaction{
+		{Input: gemini.Input{Type: gemini.InputTypeUser, Text: "test-prompt-1"}, Output: gemini.Output{Text: "test-response-1"}},
+		{Input: gemini.Input{Type: gemini.InputTypeSummary}, Output: gemini.Output{Text: strings.Repeat("s", 800)}, Summarises: 1},
+		{Input: gemini.Input{Type: gemini.InputTypeUser, Text: "test-prompt-2"}, Output: gemini.Output{Text: "test-response-2"}},
+	}
+
+	if _, compacted, err := gemini.Compact(context.Background(), cfg, history); err != nil || compacted {
+		t.Fatalf("expected the existing summary not to be summarised again. got %v, %v", compacted, err)
+	}
+}
+
+func TestCompactFailure(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer svr.Close()
+
+	cfg := gemini.Config{
+		Credential:    "test-api-key",
+		GeminiURL:     svr.URL + "/test-generate-url/?key={api-key}",
+		MaxTokens:     1000,
+		ContextBudget: 100,
+	}
+
+	history := []gemini.Transaction{}
+
+	for i := range 3 {
+		history = append(history, gemini.Transaction{
+			Input:  gemini.Input{Type: gemini.InputTypeUser, Text: strings.Repeat(string(rune('a'+i)), 400)},
+			Output: gemini.Output{Text: strings.Repeat(string(rune('a'+i)), 400)},
+		})
+	}
+
+	if _, compacted, err := gemini.Compact(context.Background(), cfg, history); err != nil || compacted {
+		t.Fatalf("expected a failed summarisation to leave the history uncompacted without error. got %v, %v", compacted, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, _, err := gemini.Compact(ctx, cfg, history); err == nil {
+		t.Fatalf("expected a cancelled summarisation to return an error. got none")
+	}
+}
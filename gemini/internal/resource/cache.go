@@ -0,0 +1,159 @@
+package resource
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/comradequinn/gen/log"
+)
+
+type (
+	// Cache records the references returned when data is uploaded, keyed by a hash of its content, so unchanged data can reuse an
+	// existing upload. entries are scoped, such as to a platform and storage location, so references are only reused where they are valid
+	Cache struct {
+		file    string
+		scope   string
+		mu      sync.Mutex
+		entries map[string]Reference
+		changed bool
+	}
+)
+
+// expiryMargin is the minimum remaining lifetime of a cached reference for it to be reused, so it does not expire while in use
+const expiryMargin = time.Hour
+
+// OpenCache reads the cache held in the specified file. a missing or unreadable cache file results in an empty cache
+func OpenCache(file, scope string) *Cache {
+	cache := &Cache{file: file, scope: scope, entries: map[string]Reference{}}
+
+	data, err := os.ReadFile(file)
+
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.DebugPrintf("unable to read upload cache. ignoring cache", "type", "upload_cache_invalid", "file", file, "err", err)
+		}
+
+		return cache
+	}
+
+	if err := json.Unmarshal(data, &cache.entries); err != nil {
+		log.DebugPrintf("unable to decode upload cache. ignoring cache", "type", "upload_cache_invalid", "file", file, "err", err)
+		cache.entries = map[string]Reference{}
+	}
+
+	return cache
+}
+
+// key returns the cache key of the source, derived from the cache scope, the source mime type and a hash of the source content
+func (c *Cache) key(source Source) (string, error) {
+	r, err := source.Open()
+
+	if err != nil {
+		return "", err
+	}
+
+	defer r.Close()
+
+	hash := sha256.New()
+
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", fmt.Errorf("unable to read '%v' to calculate content hash. %w", source.Label, err)
+	}
+
+	return c.scope + ":" + source.MIMEType + ":" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// get returns the reference cached under the key, where one exists and is not at risk of expiring
+func (c *Cache) get(key string) (Reference, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ref, ok := c.entries[key]
+
+	if !ok || (!ref.Expires.IsZero() && time.Until(ref.Expires) < expiryMargin) {
+		return Reference{}, false
+	}
+
+	return ref, true
+}
+
+func (c *Cache) put(key string, ref Reference) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key], c.changed = ref, true
+}
+
+// save writes the cache to its file, where it has changed, removing any expired entries
+func (c *Cache) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.changed {
+		return nil
+	}
+
+	for key, ref := range c.entries {
+		if !ref.Expires.IsZero() && time.Now().After(ref.Expires) {
+			delete(c.entries, key)
+		}
+	}
+
+	data, err := json.MarshalIndent(c.entries, "", "  ")
+
+	if err != nil {
+		return fmt.Errorf("unable to encode upload cache. %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.file), filepath.Base(c.file)+"-*.tmp") // unique to this process, as concurrent processes may save the cache
+
+	if err != nil {
+		return fmt.Errorf("unable to write upload cache. %w", err)
+	}
+
+	defer os.Remove(tmp.Name()) // no-op once the file is renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write upload cache. %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to write upload cache. %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), c.file); err != nil { // replace the cache atomically so a concurrent reader never sees a partial file
+		return fmt.Errorf("unable to write upload cache. %w", err)
+	}
+
+	c.changed = false
+
+	log.DebugPrintf("saved upload cache", "type", "upload_cache_saved", "file", filepath.Base(c.file), "entries", len(c.entries))
+
+	return nil
+}
+
+// Remove deletes any entries that reference the specified uris, such as when the files they identify have been deleted
+func (c *Cache) Remove(uris ...string) error {
+	c.mu.Lock()
+
+	for key, ref := range c.entries {
+		if slices.Contains(uris, ref.URI) {
+			delete(c.entries, key)
+			c.changed = true
+		}
+	}
+
+	c.mu.Unlock()
+
+	return c.save()
+}
@@ -0,0 +1,70 @@
+package resource_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/comradequinn/gen/gemini/internal/resource"
+)
+
+func TestUploadCache(t *testing.T) {
+	cacheFile := filepath.Join(t.TempDir(), "uploads.json")
+
+	tests := []struct {
+		name            string
+		scope           string
+		content         string
+		expires         time.Duration
+		expectedUploads int64
+	}{
+		{name: "initial upload", scope: "a", content: "content-1", expires: 48 * time.Hour, expectedUploads: 1},
+		{name: "unchanged content", scope: "a", content: "content-1", expires: 48 * time.Hour, expectedUploads: 0},
+		{name: "modified content", scope: "a", content: "content-2", expires: 48 * time.Hour, expectedUploads: 1},
+		{name: "different scope", scope: "b", content: "content-1", expires: 48 * time.Hour, expectedUploads: 1},
+		{name: "near expiry upload", scope: "a", content: "content-3", expires: time.Minute, expectedUploads: 1},
+		{name: "near expiry reupload", scope: "a", content: "content-3", expires: 48 * time.Hour, expectedUploads: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			uploads := atomic.Int64{}
+
+			source, err := resource.ReaderSource("file.txt", "text/plain", strings.NewReader(test.content))
+
+			if err != nil {
+				t.Fatalf("expected no error creating source, got %v", err)
+			}
+
+			refs, err := resource.Upload(context.Background(), resource.BatchUploadRequest{
+				UploadFunc: func(ctx context.Context, uploadRequest resource.UploadRequest) (resource.Reference, error) {
+					n := uploads.Add(1)
+					return resource.Reference{
+						URI:      fmt.Sprintf("uri-%v-%v", test.name, n),
+						MIMEType: uploadRequest.Source.MIMEType,
+						Label:    uploadRequest.Source.Label,
+						Expires:  time.Now().Add(test.expires),
+					}, nil
+				},
+				Cache:   resource.OpenCache(cacheFile, test.scope),
+				Sources: []resource.Source{source},
+			})
+
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			if len(refs) != 1 || refs[0].URI == "" {
+				t.Fatalf("expected a single reference, got %+v", refs)
+			}
+
+			if uploads.Load() != test.expectedUploads {
+				t.Fatalf("expected %v uploads, got %v", test.expectedUploads, uploads.Load())
+			}
+		})
+	}
+}
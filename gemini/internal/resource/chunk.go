@@ -0,0 +1,102 @@
+package resource
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	// ChunkGranularity is the unit in which resumable upload apis accept data. every chunk other than the last must be a multiple of it
+	ChunkGranularity = 256 * 1024
+	// DefaultChunkSize is the size of the chunks that data is uploaded in where no chunk size is specified
+	DefaultChunkSize = 32 * ChunkGranularity
+)
+
+type (
+	// ChunkReader reads a source in chunks for a resumable upload. the current chunk is held in memory so it can be sent again, in whole
+	// or in part, where sending it fails. the source is only reopened where an offset before the current chunk is requested
+	ChunkReader struct {
+		source    Source
+		chunkSize int64
+		r         io.ReadCloser
+		pos       int64
+		chunk     []byte
+		start     int64
+	}
+)
+
+// NewChunkReader returns a chunk reader for the source. the chunk size is rounded up to a multiple of the chunk granularity, with values
+// less than 1 resulting in the default chunk size
+func NewChunkReader(source Source, chunkSize int64) *ChunkReader {
+	if chunkSize < 1 {
+		chunkSize = DefaultChunkSize
+	}
+
+	chunkSize = (chunkSize + ChunkGranularity - 1) / ChunkGranularity * ChunkGranularity
+
+	return &ChunkReader{source: source, chunkSize: chunkSize}
+}
+
+// Chunk returns the data from the offset to the end of the chunk that contains it. an empty chunk indicates the offset is at the end
+// of the data
+func (c *ChunkReader) Chunk(offset int64) ([]byte, error) {
+	if offset >= c.start && offset < c.start+int64(len(c.chunk)) { // resume part way through the current chunk
+		return c.chunk[offset-c.start:], nil
+	}
+
+	if c.r == nil || offset < c.pos {
+		if err := c.reopen(); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := io.CopyN(io.Discard, c.r, offset-c.pos); err != nil {
+		return nil, fmt.Errorf("unable to read '%v' to offset %v. %w", c.source.Label, offset, err)
+	}
+
+	c.pos, c.start = offset, offset
+
+	if c.chunk == nil {
+		c.chunk = make([]byte, c.chunkSize)
+	}
+
+	n, err := io.ReadFull(c.r, c.chunk[:cap(c.chunk)])
+
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("unable to read '%v' for upload. %w", c.source.Label, err)
+	}
+
+	c.chunk, c.pos = c.chunk[:n], c.pos+int64(n)
+
+	return c.chunk, nil
+}
+
+// Final reports whether the chunk returned for the offset is the last in the data
+func (c *ChunkReader) Final(offset int64, chunk []byte) bool {
+	return offset+int64(len(chunk)) >= c.source.Size
+}
+
+// Close closes the source, where it is open
+func (c *ChunkReader) Close() error {
+	if c.r == nil {
+		return nil
+	}
+
+	return c.r.Close()
+}
+
+func (c *ChunkReader) reopen() error {
+	if err := c.Close(); err != nil {
+		return err
+	}
+
+	r, err := c.source.Open()
+
+	if err != nil {
+		return err
+	}
+
+	c.r, c.pos, c.chunk = r, 0, c.chunk[:0]
+
+	return nil
+}
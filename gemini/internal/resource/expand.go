@@ -0,0 +1,296 @@
+package resource
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/comradequinn/gen/log"
+)
+
+type (
+	// ignoreRule is a single pattern from a .gitignore or .genignore file
+	ignoreRule struct {
+		dir     string
+		re      *regexp.Regexp
+		negate  bool
+		dirOnly bool
+	}
+	ignoreRules []ignoreRule
+)
+
+var ignoreFileNames = []string{".gitignore", ".genignore"}
+
+// Expand resolves the specified paths into a list of files. directories are walked recursively and glob patterns, including '**' to match
+// any number of directories, are matched against the files beneath their static prefix. files found by walking a directory or matching a
+// pattern are skipped if they are excluded by a .gitignore or .genignore file, are binary files of an unsupported type or exceed the
+// maximum size, where one is specified. paths that identify files directly are returned as they are. where a path is suffixed with
+// ':{mime-type}', the suffix is applied to each file it resolves to. remote urls are returned as they are
+func Expand(paths []string, maxFileSize int64) ([]string, error) {
+	files := []string{}
+
+	add := func(f string) {
+		if !slices.Contains(files, f) {
+			files = append(files, f)
+		}
+	}
+
+	for _, p := range paths {
+		if IsRemote(p) {
+			add(p)
+			continue
+		}
+
+		p, mimeType := SplitMIMEType(p)
+
+		if mimeType != "" {
+			mimeType = ":" + mimeType
+		}
+
+		fileInfo, err := FileIO.Stat(p) // paths that exist are not treated as patterns, so files with names such as '[id].tsx' can be attached
+
+		if (err == nil && !fileInfo.IsDir()) || (err != nil && !isPattern(p)) {
+			add(p + mimeType) // missing files are reported when they are uploaded
+			continue
+		}
+
+		root, match := filepath.ToSlash(filepath.Clean(p)), (*regexp.Regexp)(nil)
+
+		if err != nil {
+			if root, match, err = patternRoot(p); err != nil {
+				return nil, err
+			}
+		}
+
+		rules := loadAncestorIgnoreRules(root)
+
+		err = filepath.WalkDir(root, func(f string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return fmt.Errorf("unable to read '%v'. %w", f, err)
+			}
+
+			slashPath := filepath.ToSlash(f)
+
+			if d.IsDir() {
+				if f != root && (d.Name() == ".git" || rules.ignored(slashPath, true)) {
+					return fs.SkipDir
+				}
+
+				rules = append(rules, loadIgnoreRules(slashPath)...)
+				return nil
+			}
+
+			if !d.Type().IsRegular() || rules.ignored(slashPath, false) || (match != nil && !match.MatchString(slashPath)) {
+				return nil
+			}
+
+			if skip, reason := skipFile(f+mimeType, maxFileSize); skip {
+				log.DebugPrintf("skipping file", "type", "file_skipped", "file", f, "reason", reason)
+				return nil
+			}
+
+			add(f + mimeType)
+
+			return nil
+		})
+
+		if err != nil {
+			return nil, fmt.Errorf("unable to expand '%v'. %w", p, err)
+		}
+	}
+
+	return files, nil
+}
+
+func isPattern(p string) bool {
+	return strings.ContainsAny(p, "*?[")
+}
+
+// patternRoot returns the directory to walk for the path and, where the path is a glob pattern, the expression files must match
+func patternRoot(p string) (string, *regexp.Regexp, error) {
+	p = filepath.ToSlash(filepath.Clean(p))
+
+	if !isPattern(p) {
+		return p, nil, nil
+	}
+
+	segments, root := strings.Split(p, "/"), []string{}
+
+	for _, s := range segments {
+		if isPattern(s) {
+			break
+		}
+
+		root = append(root, s)
+	}
+
+	re, err := globRegexp(p)
+
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid file pattern '%v'. %w", p, err)
+	}
+
+	switch {
+	case len(root) == 0:
+		return ".", re, nil
+	case len(root) == 1 && root[0] == "":
+		return "/", re, nil
+	default:
+		return filepath.FromSlash(strings.Join(root, "/")), re, nil
+	}
+}
+
+// globRegexp converts a glob pattern to an equivalent regular expression. '*' and '?' do not match '/', while '**' matches any number of directories
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	re := strings.Builder{}
+
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i:], ']')
+
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated character class")
+			}
+
+			class := pattern[i+1 : i+end]
+
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+
+			re.WriteString("[" + class + "]")
+			i += end
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	return regexp.Compile("^" + re.String() + "$")
+}
+
+// loadAncestorIgnoreRules loads the ignore rules from each directory between the working directory and the specified relative root, inclusive.
+// the root's own rules are loaded once it is walked, so are excluded here
+func loadAncestorIgnoreRules(root string) ignoreRules {
+	rules, root := ignoreRules{}, filepath.ToSlash(root)
+
+	if path.IsAbs(root) || strings.HasPrefix(root, "..") || root == "." {
+		return rules
+	}
+
+	rules = append(rules, loadIgnoreRules(".")...)
+
+	for i, c := range root {
+		if c == '/' {
+			rules = append(rules, loadIgnoreRules(root[:i])...)
+		}
+	}
+
+	return rules
+}
+
+// loadIgnoreRules reads the ignore files in the specified directory
+func loadIgnoreRules(dir string) ignoreRules {
+	rules := ignoreRules{}
+
+	for _, name := range ignoreFileNames {
+		data, err := os.ReadFile(filepath.Join(filepath.FromSlash(dir), name))
+
+		if err != nil {
+			continue
+		}
+
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			rule := ignoreRule{dir: dir}
+
+			if rule.negate = strings.HasPrefix(line, "!"); rule.negate {
+				line = line[1:]
+			}
+
+			if rule.dirOnly = strings.HasSuffix(line, "/"); rule.dirOnly {
+				line = strings.TrimSuffix(line, "/")
+			}
+
+			if !strings.Contains(line, "/") { // patterns without a separator match at any depth
+				line = "**/" + line
+			}
+
+			re, err := globRegexp(strings.TrimPrefix(line, "/"))
+
+			if err != nil {
+				log.DebugPrintf("ignoring invalid ignore file pattern", "type", "ignore_rule_invalid", "dir", dir, "file", name, "pattern", scanner.Text(), "err", err)
+				continue
+			}
+
+			rule.re = re
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules
+}
+
+// ignored returns whether the slash separated path is excluded by the rules. as in git, the last matching rule takes precedence
+func (rules ignoreRules) ignored(slashPath string, isDir bool) bool {
+	ignored := false
+
+	for _, rule := range rules {
+		rel := slashPath
+
+		if rule.dir != "." {
+			if !strings.HasPrefix(slashPath, rule.dir+"/") {
+				continue
+			}
+
+			rel = strings.TrimPrefix(slashPath, rule.dir+"/")
+		}
+
+		if (rule.dirOnly && !isDir) || !rule.re.MatchString(rel) {
+			continue
+		}
+
+		ignored = !rule.negate
+	}
+
+	return ignored
+}
+
+// skipFile returns whether a file found by expanding a directory or pattern should be excluded, such as binary files of unsupported types, and why
+func skipFile(file string, maxFileSize int64) (bool, string) {
+	fileInfo, _, err := FileInfo(file)
+
+	if err != nil {
+		return true, err.Error()
+	}
+
+	if maxFileSize > 0 && fileInfo.Size() > maxFileSize {
+		return true, fmt.Sprintf("file size of %v bytes exceeds the maximum of %v bytes", fileInfo.Size(), maxFileSize)
+	}
+
+	return false, ""
+}
@@ -0,0 +1,107 @@
+package resource_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/comradequinn/gen/gemini/internal/resource"
+	"github.com/comradequinn/gen/log"
+)
+
+func TestMain(m *testing.M) {
+	log.Init(false, func(string, ...any) {})
+	os.Exit(m.Run())
+}
+
+func TestExpand(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	files := map[string]string{
+		".gitignore":           "build/\n*.log\n",
+		"main.go":              "package main",
+		"README.md":            "# readme",
+		"debug.log":            "ignored",
+		"build/out.go":         "package build",
+		"pkg/a.go":             "package pkg",
+		"pkg/a_test.go":        "package pkg",
+		"pkg/.genignore":       "*_test.go\n!keep_test.go\n",
+		"pkg/keep_test.go":     "package pkg",
+		"pkg/deep/b.go":        "package deep",
+		"pkg/deep/large.txt":   strings.Repeat("x", 64),
+		"pkg/deep/binary.txt":  "bin\x00ary",
+		".git/config":          "[core]",
+		"explicit/ignored.log": "attached directly",
+		"routes/[id].tsx":      "export {}",
+		"app/[slug]/page.tsx":  "export {}",
+	}
+
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatalf("unable to create test directory. %v", err)
+		}
+
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatalf("unable to create test file. %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		paths    []string
+		expected []string
+	}{
+		{
+			name:     "directory",
+			paths:    []string{"."},
+			expected: []string{".gitignore", "README.md", "app/[slug]/page.tsx", "main.go", "pkg/.genignore", "pkg/a.go", "pkg/deep/b.go", "pkg/keep_test.go", "routes/[id].tsx"},
+		},
+		{
+			name:     "nested directory",
+			paths:    []string{"pkg/deep"},
+			expected: []string{"pkg/deep/b.go"},
+		},
+		{
+			name:     "recursive glob",
+			paths:    []string{"**/*.go"},
+			expected: []string{"main.go", "pkg/a.go", "pkg/deep/b.go", "pkg/keep_test.go"},
+		},
+		{
+			name:     "single level glob",
+			paths:    []string{"pkg/*.go"},
+			expected: []string{"pkg/a.go", "pkg/keep_test.go"},
+		},
+		{
+			name:     "explicit files are not filtered",
+			paths:    []string{"explicit/ignored.log", "main.go", "main.go"},
+			expected: []string{"explicit/ignored.log", "main.go"},
+		},
+		{
+			name:     "paths containing pattern characters that exist",
+			paths:    []string{"routes/[id].tsx", "app/[slug]"},
+			expected: []string{"app/[slug]/page.tsx", "routes/[id].tsx"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := resource.Expand(test.paths, 32)
+
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			for i := range actual {
+				actual[i] = filepath.ToSlash(actual[i])
+			}
+
+			slices.Sort(actual)
+
+			if !slices.Equal(actual, test.expected) {
+				t.Fatalf("expected files %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@
 package gcs
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -13,53 +15,116 @@ import (
 	"time"
 
 	"github.com/comradequinn/gen/gemini/internal/resource"
+	"github.com/comradequinn/gen/gemini/internal/retry"
 	"github.com/comradequinn/gen/log"
 )
 
-func Upload(uploadRequest resource.UploadRequest) (resource.Reference, error) {
+func Upload(ctx context.Context, uploadRequest resource.UploadRequest) (resource.Reference, error) {
+	source := uploadRequest.Source
 
-	fileInfo, contentType, err := resource.FileInfo(uploadRequest.File)
+	url := strings.ReplaceAll(uploadRequest.URL, "{file-name}", url.QueryEscape(fmt.Sprintf("%v%v-%v-%v", resource.ObjectPrefix, source.Label, strconv.FormatInt(time.Now().UnixNano(), 10), strconv.Itoa(rand.Int()))))
 
-	if err != nil {
-		return resource.Reference{}, err
-	}
+	rs, err := uploadRequest.Retry.Do(ctx, "start-upload", func() (*http.Response, error) {
+		rq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+		if err != nil {
+			return nil, retry.Permanent(fmt.Errorf("unable to create start-upload request. %w", err))
+		}
+
+		rq.Header.Set("Authorization", "Bearer "+uploadRequest.Credential)
+		rq.Header.Set("X-Upload-Content-Type", source.MIMEType)
+		rq.Header.Set("X-Upload-Content-Length", strconv.FormatInt(source.Size, 10))
 
-	file, err := resource.FileIO.Open(uploadRequest.File)
+		log.DebugPrintf("sending start upload request", "type", "start_upload_request", "url", url)
 
+		return uploadRequest.HTTPClient.Do(rq)
+	})
 	if err != nil {
-		return resource.Reference{}, fmt.Errorf("unable to open file '%v' for upload. %w", uploadRequest.File, err)
+		return resource.Reference{}, fmt.Errorf("error starting file upload. %w", err)
 	}
 
-	defer file.Close()
+	body, _ := io.ReadAll(rs.Body)
+	rs.Body.Close()
 
-	url := strings.ReplaceAll(uploadRequest.URL, "{file-name}", url.QueryEscape(fmt.Sprintf("gen-attachment-%v-%v-%v", fileInfo.Name(), strconv.FormatInt(time.Now().UnixNano(), 10), strconv.Itoa(rand.Int()))))
+	log.DebugPrintf("received start upload response", "type", "start_upload_response", "status", rs.Status, "response", string(body))
 
-	rq, err := http.NewRequest(http.MethodPost, url, file)
-	if err != nil {
-		return resource.Reference{}, fmt.Errorf("unable to create upload-request. %w", err)
+	if rs.StatusCode != http.StatusOK {
+		return resource.Reference{}, fmt.Errorf("start-upload request failed with status code %v. %v", rs.StatusCode, string(body))
 	}
 
-	rq.Header.Set("Content-Type", contentType)
-	rq.Header.Set("Authorization", "Bearer "+uploadRequest.Credential)
+	sessionURL := rs.Header.Get("Location")
+	if sessionURL == "" {
+		return resource.Reference{}, fmt.Errorf("upload session url not found in start-upload response header of 'location'")
+	}
 
-	log.DebugPrintf("sending upload request", "type", "upload_request", "url", url, "headers", rq.Header, "bytes", strconv.FormatInt(fileInfo.Size(), 10))
+	chunks := resource.NewChunkReader(source, uploadRequest.ChunkSize)
+	defer chunks.Close()
 
-	rs, err := http.DefaultClient.Do(rq)
-	if err != nil {
-		return resource.Reference{}, fmt.Errorf("error during upload-request. %w", err)
-	}
-	defer rs.Body.Close()
+	offset, resume := int64(0), false
 
-	body, err := io.ReadAll(rs.Body)
+	for {
+		rs, err = uploadRequest.Retry.Do(ctx, "upload", func() (*http.Response, error) {
+			if resume { // a previous attempt failed, so continue from the offset the server acknowledges receiving
+				rs, received, err := query(ctx, uploadRequest, sessionURL)
 
-	if err != nil {
-		return resource.Reference{}, fmt.Errorf("unable to read response body. %w", err)
-	}
+				if err != nil || rs != nil {
+					return rs, err
+				}
+
+				offset = received
+			}
+
+			resume = true
+
+			chunk, err := chunks.Chunk(offset)
+
+			if err != nil {
+				return nil, retry.Permanent(err)
+			}
+
+			rq, err := http.NewRequestWithContext(ctx, http.MethodPut, sessionURL, bytes.NewReader(chunk))
+			if err != nil {
+				return nil, retry.Permanent(fmt.Errorf("unable to create upload-request. %w", err))
+			}
+
+			contentRange := fmt.Sprintf("bytes %v-%v/%v", offset, offset+int64(len(chunk))-1, source.Size)
+
+			if len(chunk) == 0 {
+				contentRange = fmt.Sprintf("bytes */%v", source.Size)
+			}
+
+			rq.Header.Set("Authorization", "Bearer "+uploadRequest.Credential)
+			rq.Header.Set("Content-Range", contentRange)
+
+			log.DebugPrintf("sending upload request", "type", "upload_request", "url", sessionURL, "content_range", contentRange)
+
+			return uploadRequest.HTTPClient.Do(rq)
+		})
+		if err != nil {
+			return resource.Reference{}, fmt.Errorf("error during upload-request. %w", err)
+		}
+
+		resume = false
 
-	log.DebugPrintf("received upload response", "type", "upload_response", "status", rs.Status, "response", string(body))
+		body, err = io.ReadAll(rs.Body)
+		rs.Body.Close()
 
-	if rs.StatusCode != http.StatusOK || err != nil {
-		return resource.Reference{}, fmt.Errorf("upload-request failed with status code %v. error: %w. body: %v", rs.StatusCode, err, string(body))
+		if err != nil {
+			return resource.Reference{}, fmt.Errorf("unable to read response body. %w", err)
+		}
+
+		log.DebugPrintf("received upload response", "type", "upload_response", "status", rs.Status, "range", rs.Header.Get("Range"), "response", string(body))
+
+		if rs.StatusCode != http.StatusPermanentRedirect { // a 308 status indicates the upload is incomplete
+			break
+		}
+
+		if offset, err = received(rs.Header); err != nil {
+			return resource.Reference{}, err
+		}
+	}
+
+	if rs.StatusCode != http.StatusOK && rs.StatusCode != http.StatusCreated {
+		return resource.Reference{}, fmt.Errorf("upload-request failed with status code %v. body: %v", rs.StatusCode, string(body))
 	}
 
 	uploadResponse := struct {
@@ -75,6 +140,154 @@ func Upload(uploadRequest resource.UploadRequest) (resource.Reference, error) {
 	return resource.Reference{
 		URI:      fmt.Sprintf("gs://%v/%v", uploadResponse.Bucket, uploadResponse.Name),
 		MIMEType: uploadResponse.ContentType,
-		Label:    fileInfo.Name(),
+		Label:    source.Label,
 	}, nil
 }
+
+// query returns the number of bytes of an upload the server has received. where the upload has already completed, or the query fails,
+// the response is returned instead, for the caller to handle as the response to the upload
+func query(ctx context.Context, uploadRequest resource.UploadRequest, sessionURL string) (*http.Response, int64, error) {
+	rq, err := http.NewRequestWithContext(ctx, http.MethodPut, sessionURL, nil)
+
+	if err != nil {
+		return nil, 0, retry.Permanent(fmt.Errorf("unable to create query-upload request. %w", err))
+	}
+
+	rq.Header.Set("Authorization", "Bearer "+uploadRequest.Credential)
+	rq.Header.Set("Content-Range", fmt.Sprintf("bytes */%v", uploadRequest.Source.Size))
+
+	log.DebugPrintf("sending query upload request", "type", "query_upload_request", "url", sessionURL)
+
+	rs, err := uploadRequest.HTTPClient.Do(rq)
+
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to query upload status. %w", err)
+	}
+
+	log.DebugPrintf("received query upload response", "type", "query_upload_response", "status", rs.Status, "range", rs.Header.Get("Range"))
+
+	if rs.StatusCode != http.StatusPermanentRedirect {
+		return rs, 0, nil
+	}
+
+	rs.Body.Close()
+
+	n, err := received(rs.Header)
+
+	if err != nil {
+		return nil, 0, retry.Permanent(err)
+	}
+
+	return nil, n, nil
+}
+
+// received returns the number of bytes of an incomplete upload the server has persisted, as indicated by the range header of the response
+func received(header http.Header) (int64, error) {
+	r := header.Get("Range")
+
+	if r == "" {
+		return 0, nil
+	}
+
+	_, end, found := strings.Cut(strings.TrimPrefix(r, "bytes="), "-")
+
+	n, err := strconv.ParseInt(end, 10, 64)
+
+	if !found || err != nil {
+		return 0, fmt.Errorf("invalid range header '%v' in upload response", r)
+	}
+
+	return n + 1, nil
+}
+
+// List returns the objects uploaded to the bucket by gen
+func List(ctx context.Context, fileRequest resource.FileRequest) ([]resource.Object, error) {
+	objects, pageToken := []resource.Object{}, ""
+
+	for {
+		listURL := fileRequest.URL + "?prefix=" + url.QueryEscape(resource.ObjectPrefix)
+
+		if pageToken != "" {
+			listURL += "&pageToken=" + url.QueryEscape(pageToken)
+		}
+
+		listResponse := struct {
+			Items []struct {
+				Name        string    `json:"name"`
+				Bucket      string    `json:"bucket"`
+				TimeCreated time.Time `json:"timeCreated"`
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}{}
+
+		if err := send(ctx, fileRequest, http.MethodGet, listURL, "list-objects", &listResponse); err != nil {
+			return nil, err
+		}
+
+		for _, item := range listResponse.Items {
+			objects = append(objects, resource.Object{URI: fmt.Sprintf("gs://%v/%v", item.Bucket, item.Name), Name: item.Name, Created: item.TimeCreated})
+		}
+
+		if pageToken = listResponse.NextPageToken; pageToken == "" {
+			return objects, nil
+		}
+	}
+}
+
+// Delete removes the object with the specified gs:// uri. objects that no longer exist are ignored
+func Delete(ctx context.Context, fileRequest resource.FileRequest, uri string) error {
+	_, name, found := strings.Cut(strings.TrimPrefix(uri, "gs://"), "/")
+
+	if !found {
+		return fmt.Errorf("invalid cloud storage uri '%v'", uri)
+	}
+
+	if !strings.HasPrefix(name, resource.ObjectPrefix) { // objects attached by uri were not uploaded by gen, so are never deleted
+		log.DebugPrintf("skipping deletion of object not uploaded by gen", "type", "delete_object_skipped", "uri", uri)
+		return nil
+	}
+
+	return send(ctx, fileRequest, http.MethodDelete, resource.ObjectURL(fileRequest.URL, name), "delete-object", nil)
+}
+
+// send makes a request to the cloud storage api and decodes the response into the target, where one is specified
+func send(ctx context.Context, fileRequest resource.FileRequest, method, url, desc string, target any) error {
+	rs, err := fileRequest.Retry.Do(ctx, desc, func() (*http.Response, error) {
+		rq, err := http.NewRequestWithContext(ctx, method, url, nil)
+
+		if err != nil {
+			return nil, retry.Permanent(fmt.Errorf("unable to create %v request. %w", desc, err))
+		}
+
+		rq.Header.Set("Authorization", "Bearer "+fileRequest.Credential)
+
+		log.DebugPrintf("sending cloud storage request", "type", "storage_request", "request", desc, "url", url)
+
+		return fileRequest.HTTPClient.Do(rq)
+	})
+
+	if err != nil {
+		return fmt.Errorf("error during %v request. %w", desc, err)
+	}
+
+	defer rs.Body.Close()
+
+	body, err := io.ReadAll(rs.Body)
+
+	log.DebugPrintf("received cloud storage response", "type", "storage_response", "request", desc, "status", rs.Status, "response", string(body))
+
+	switch {
+	case err != nil:
+		return fmt.Errorf("unable to read %v response body. %w", desc, err)
+	case method == http.MethodDelete && rs.StatusCode == http.StatusNotFound:
+		return nil
+	case rs.StatusCode != http.StatusOK && rs.StatusCode != http.StatusNoContent:
+		return fmt.Errorf("%v request failed with status code %v. %v", desc, rs.StatusCode, string(body))
+	case target != nil:
+		if err := json.Unmarshal(body, target); err != nil {
+			return fmt.Errorf("unable to decode %v response. %w", desc, err)
+		}
+	}
+
+	return nil
+}
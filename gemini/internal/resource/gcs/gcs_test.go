@@ -0,0 +1,107 @@
+package gcs_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/comradequinn/gen/gemini/internal/resource"
+	"github.com/comradequinn/gen/gemini/internal/resource/gcs"
+	"github.com/comradequinn/gen/gemini/internal/retry"
+	"github.com/comradequinn/gen/log"
+)
+
+func TestMain(m *testing.M) {
+	log.Init(false, func(string, ...any) {})
+	os.Exit(m.Run())
+}
+
+func TestUploadResumes(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), (resource.ChunkGranularity*3+100)/16)
+
+	var (
+		received []byte
+		chunks   int
+		queries  int
+		dropped  bool
+	)
+
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			t.Fatalf("expected bearer token to be sent. got %q", r.Header.Get("Authorization"))
+		}
+
+		incomplete := func() {
+			if len(received) > 0 {
+				w.Header().Set("Range", fmt.Sprintf("bytes=0-%v", len(received)-1))
+			}
+
+			w.WriteHeader(http.StatusPermanentRedirect)
+		}
+
+		switch {
+		case r.Method == http.MethodPost:
+			w.Header().Set("Location", "http://"+r.Host+"/session")
+		case r.Header.Get("Content-Range") == fmt.Sprintf("bytes */%v", len(data)):
+			queries++
+			incomplete()
+		default:
+			chunks++
+
+			if expected := fmt.Sprintf("bytes %v-", len(received)); !bytes.HasPrefix([]byte(r.Header.Get("Content-Range")), []byte(expected)) {
+				t.Fatalf("expected content range starting %q. got %q", expected, r.Header.Get("Content-Range"))
+			}
+
+			body, _ := io.ReadAll(r.Body)
+
+			if chunks == 2 && !dropped { // persist part of the second chunk, then drop the connection
+				dropped, received = true, append(received, body[:resource.ChunkGranularity/2]...)
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				conn.Close()
+				return
+			}
+
+			if received = append(received, body...); len(received) < len(data) {
+				incomplete()
+				return
+			}
+
+			fmt.Fprintf(w, `{"name":"test-object","bucket":"test-bucket","contentType":"text/plain"}`)
+		}
+	}))
+
+	defer svr.Close()
+
+	source, _ := resource.ReaderSource("file.txt", "text/plain", bytes.NewReader(data))
+
+	ref, err := gcs.Upload(context.Background(), resource.UploadRequest{
+		URL:        svr.URL + "/upload?uploadType=resumable&name={file-name}",
+		Credential: "test-token",
+		HTTPClient: svr.Client(),
+		Retry:      retry.Policy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+		ChunkSize:  resource.ChunkGranularity,
+		Source:     source,
+	})
+
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if ref.URI != "gs://test-bucket/test-object" {
+		t.Fatalf("expected uri of gs://test-bucket/test-object, got %v", ref.URI)
+	}
+
+	if queries != 1 {
+		t.Fatalf("expected upload status to be queried once after the dropped connection. got %v queries", queries)
+	}
+
+	if !bytes.Equal(received, data) {
+		t.Fatalf("expected server to receive all %v bytes of data once. got %v bytes", len(data), len(received))
+	}
+}
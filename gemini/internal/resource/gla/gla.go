@@ -2,42 +2,62 @@
 package gla
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"path"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/comradequinn/gen/gemini/internal/resource"
+	"github.com/comradequinn/gen/gemini/internal/retry"
 	"github.com/comradequinn/gen/log"
 )
 
-func Upload(uploadRequest resource.UploadRequest) (resource.Reference, error) {
+// defaultExpiry is the lifetime of files uploaded to the files api, assumed where the upload response does not specify an expiration time
+const defaultExpiry = 48 * time.Hour
 
-	fileInfo, contentType, err := resource.FileInfo(uploadRequest.File)
-
-	if err != nil {
-		return resource.Reference{}, err
-	}
+func Upload(ctx context.Context, uploadRequest resource.UploadRequest) (resource.Reference, error) {
+	source := uploadRequest.Source
 
 	url := strings.ReplaceAll(uploadRequest.URL, "{api-key}", uploadRequest.Credential)
 
-	rq, err := http.NewRequest(http.MethodPost, url, strings.NewReader(fmt.Sprintf(`{"file":{"display_name":"%v"}}`, fileInfo.Name())))
+	startRequest := struct {
+		File struct {
+			DisplayName string `json:"display_name"`
+		} `json:"file"`
+	}{}
+
+	startRequest.File.DisplayName = resource.ObjectPrefix + source.Label
+
+	startBody, err := json.Marshal(startRequest)
 
 	if err != nil {
-		return resource.Reference{}, fmt.Errorf("unable to create start-upload request. %w", err)
+		return resource.Reference{}, fmt.Errorf("unable to encode start-upload request. %w", err)
 	}
 
-	rq.Header.Set("X-Goog-Upload-Protocol", "resumable")
-	rq.Header.Set("X-Goog-Upload-Command", "start")
-	rq.Header.Set("X-Goog-Upload-Header-Content-Length", strconv.FormatInt(fileInfo.Size(), 10))
-	rq.Header.Set("X-Goog-Upload-Header-Content-Type", contentType)
-	rq.Header.Set("Content-Type", "application/json")
+	rs, err := uploadRequest.Retry.Do(ctx, "start-upload", func() (*http.Response, error) {
+		rq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(startBody))
+
+		if err != nil {
+			return nil, retry.Permanent(fmt.Errorf("unable to create start-upload request. %w", err))
+		}
 
-	log.DebugPrintf("sending start upload request", "type", "start_upload_request", "url", url, "headers", rq.Header)
+		rq.Header.Set("X-Goog-Upload-Protocol", "resumable")
+		rq.Header.Set("X-Goog-Upload-Command", "start")
+		rq.Header.Set("X-Goog-Upload-Header-Content-Length", strconv.FormatInt(source.Size, 10))
+		rq.Header.Set("X-Goog-Upload-Header-Content-Type", source.MIMEType)
+		rq.Header.Set("Content-Type", "application/json")
 
-	rs, err := http.DefaultClient.Do(rq)
+		log.DebugPrintf("sending start upload request", "type", "start_upload_request", "url", url, "headers", rq.Header)
+
+		return uploadRequest.HTTPClient.Do(rq)
+	})
 	if err != nil {
 		return resource.Reference{}, fmt.Errorf("error starting file upload. %w", err)
 	}
@@ -56,41 +76,80 @@ func Upload(uploadRequest resource.UploadRequest) (resource.Reference, error) {
 		return resource.Reference{}, fmt.Errorf("upload url not found in start-upload response header of 'x-goog-upload-url'")
 	}
 
-	file, err := resource.FileIO.Open(uploadRequest.File)
-	if err != nil {
-		return resource.Reference{}, fmt.Errorf("unable to open file '%v' for upload. %w", uploadRequest.File, err)
-	}
-	defer file.Close()
+	chunks := resource.NewChunkReader(source, uploadRequest.ChunkSize)
+	defer chunks.Close()
 
-	rq, err = http.NewRequest(http.MethodPost, uploadURL, file) // Use the file as the request body
-	if err != nil {
-		return resource.Reference{}, fmt.Errorf("unable to create upload-request. %w", err)
-	}
+	offset, resume := int64(0), false
 
-	rq.Header.Set("Content-Length", strconv.FormatInt(fileInfo.Size(), 10))
-	rq.Header.Set("X-Goog-Upload-Offset", "0")
-	rq.Header.Set("X-Goog-Upload-Command", "upload, finalize")
+	for {
+		sent := 0
 
-	log.DebugPrintf("sending upload request", "type", "upload_request", "url", url, "headers", rq.Header, "bytes", strconv.FormatInt(fileInfo.Size(), 10))
+		rs, err = uploadRequest.Retry.Do(ctx, "upload", func() (*http.Response, error) {
+			if resume { // a previous attempt failed, so continue from the offset the server acknowledges receiving
+				rs, received, err := query(ctx, uploadRequest, uploadURL)
 
-	rs, err = http.DefaultClient.Do(rq)
-	if err != nil {
-		return resource.Reference{}, fmt.Errorf("error during upload-request. %w", err)
-	}
-	defer rs.Body.Close()
+				if err != nil || rs != nil {
+					return rs, err
+				}
+
+				offset = received
+			}
+
+			resume = true
+
+			chunk, err := chunks.Chunk(offset)
+
+			if err != nil {
+				return nil, retry.Permanent(err)
+			}
 
-	body, err = io.ReadAll(rs.Body)
+			rq, err := http.NewRequestWithContext(ctx, http.MethodPost, uploadURL, bytes.NewReader(chunk))
+			if err != nil {
+				return nil, retry.Permanent(fmt.Errorf("unable to create upload-request. %w", err))
+			}
 
-	log.DebugPrintf("received upload response", "type", "upload_response", "status", rs.Status, "response", string(body))
+			command := "upload"
 
-	if rs.StatusCode != http.StatusOK || err != nil {
-		return resource.Reference{}, fmt.Errorf("upload-request failed with status code %v. error: %w. body: %v", rs.StatusCode, err, string(body))
+			if chunks.Final(offset, chunk) {
+				command = "upload, finalize"
+			}
+
+			rq.Header.Set("X-Goog-Upload-Offset", strconv.FormatInt(offset, 10))
+			rq.Header.Set("X-Goog-Upload-Command", command)
+
+			log.DebugPrintf("sending upload request", "type", "upload_request", "url", url, "headers", rq.Header, "bytes", len(chunk))
+
+			sent = len(chunk)
+
+			return uploadRequest.HTTPClient.Do(rq)
+		})
+		if err != nil {
+			return resource.Reference{}, fmt.Errorf("error during upload-request. %w", err)
+		}
+
+		resume = false
+
+		body, err = io.ReadAll(rs.Body)
+		rs.Body.Close()
+
+		log.DebugPrintf("received upload response", "type", "upload_response", "status", rs.Status, "upload_status", rs.Header.Get("X-Goog-Upload-Status"), "response", string(body))
+
+		if rs.StatusCode != http.StatusOK || err != nil {
+			return resource.Reference{}, fmt.Errorf("upload-request failed with status code %v. error: %w. body: %v", rs.StatusCode, err, string(body))
+		}
+
+		if rs.Header.Get("X-Goog-Upload-Status") != "active" {
+			break
+		}
+
+		offset += int64(sent)
 	}
 
 	uploadResponse := struct {
 		File struct {
-			MimeType string `json:"mimeType"`
-			URI      string `json:"uri"`
+			MimeType       string    `json:"mimeType"`
+			URI            string    `json:"uri"`
+			ExpirationTime time.Time `json:"expirationTime"`
 		} `json:"file"`
 	}{}
 
@@ -98,9 +157,135 @@ func Upload(uploadRequest resource.UploadRequest) (resource.Reference, error) {
 		return resource.Reference{}, fmt.Errorf("unable to marshal upload-request response. %w", err)
 	}
 
+	if uploadResponse.File.ExpirationTime.IsZero() {
+		uploadResponse.File.ExpirationTime = time.Now().Add(defaultExpiry)
+	}
+
 	return resource.Reference{
 		URI:      uploadResponse.File.URI,
 		MIMEType: uploadResponse.File.MimeType,
-		Label:    fileInfo.Name(),
+		Label:    source.Label,
+		Expires:  uploadResponse.File.ExpirationTime,
 	}, nil
 }
+
+// query returns the number of bytes of an upload the server has received. where the upload has already completed, or the query fails,
+// the response is returned instead, for the caller to handle as the response to the upload
+func query(ctx context.Context, uploadRequest resource.UploadRequest, uploadURL string) (*http.Response, int64, error) {
+	rq, err := http.NewRequestWithContext(ctx, http.MethodPost, uploadURL, nil)
+
+	if err != nil {
+		return nil, 0, retry.Permanent(fmt.Errorf("unable to create query-upload request. %w", err))
+	}
+
+	rq.Header.Set("X-Goog-Upload-Command", "query")
+
+	log.DebugPrintf("sending query upload request", "type", "query_upload_request", "url", uploadURL)
+
+	rs, err := uploadRequest.HTTPClient.Do(rq)
+
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to query upload status. %w", err)
+	}
+
+	status := rs.Header.Get("X-Goog-Upload-Status")
+
+	log.DebugPrintf("received query upload response", "type", "query_upload_response", "status", rs.Status, "upload_status", status, "received", rs.Header.Get("X-Goog-Upload-Size-Received"))
+
+	if rs.StatusCode != http.StatusOK || status != "active" {
+		return rs, 0, nil
+	}
+
+	rs.Body.Close()
+
+	received, err := strconv.ParseInt(rs.Header.Get("X-Goog-Upload-Size-Received"), 10, 64)
+
+	if err != nil {
+		return nil, 0, retry.Permanent(fmt.Errorf("invalid size received in query-upload response. %w", err))
+	}
+
+	return nil, received, nil
+}
+
+// List returns the files uploaded by gen that have not yet expired
+func List(ctx context.Context, fileRequest resource.FileRequest) ([]resource.Object, error) {
+	objects, pageToken := []resource.Object{}, ""
+
+	for {
+		listURL := strings.ReplaceAll(fileRequest.URL, "{api-key}", fileRequest.Credential)
+
+		if pageToken != "" {
+			listURL += "&pageToken=" + url.QueryEscape(pageToken)
+		}
+
+		listResponse := struct {
+			Files []struct {
+				URI         string    `json:"uri"`
+				DisplayName string    `json:"displayName"`
+				CreateTime  time.Time `json:"createTime"`
+			} `json:"files"`
+			NextPageToken string `json:"nextPageToken"`
+		}{}
+
+		if err := send(ctx, fileRequest, http.MethodGet, listURL, "list-files", &listResponse); err != nil {
+			return nil, err
+		}
+
+		for _, f := range listResponse.Files {
+			if strings.HasPrefix(f.DisplayName, resource.ObjectPrefix) {
+				objects = append(objects, resource.Object{URI: f.URI, Name: f.DisplayName, Created: f.CreateTime})
+			}
+		}
+
+		if pageToken = listResponse.NextPageToken; pageToken == "" {
+			return objects, nil
+		}
+	}
+}
+
+// Delete removes the uploaded file with the specified uri. files that no longer exist, such as those that have expired, are ignored
+func Delete(ctx context.Context, fileRequest resource.FileRequest, uri string) error {
+	deleteURL := strings.ReplaceAll(resource.ObjectURL(fileRequest.URL, path.Base(uri)), "{api-key}", fileRequest.Credential)
+
+	return send(ctx, fileRequest, http.MethodDelete, deleteURL, "delete-file", nil)
+}
+
+// send makes a request to the files api and decodes the response into the target, where one is specified
+func send(ctx context.Context, fileRequest resource.FileRequest, method, url, desc string, target any) error {
+	rs, err := fileRequest.Retry.Do(ctx, desc, func() (*http.Response, error) {
+		rq, err := http.NewRequestWithContext(ctx, method, url, nil)
+
+		if err != nil {
+			return nil, retry.Permanent(fmt.Errorf("unable to create %v request. %w", desc, err))
+		}
+
+		log.DebugPrintf("sending files api request", "type", "files_request", "request", desc, "url", url)
+
+		return fileRequest.HTTPClient.Do(rq)
+	})
+
+	if err != nil {
+		return fmt.Errorf("error during %v request. %w", desc, err)
+	}
+
+	defer rs.Body.Close()
+
+	body, err := io.ReadAll(rs.Body)
+
+	log.DebugPrintf("received files api response", "type", "files_response", "request", desc, "status", rs.Status, "response", string(body))
+
+	switch {
+	case err != nil:
+		return fmt.Errorf("unable to read %v response body. %w", desc, err)
+	case method == http.MethodDelete && rs.StatusCode == http.StatusNotFound:
+		return nil
+	case rs.StatusCode != http.StatusOK:
+		return fmt.Errorf("%v request failed with status code %v. %v", desc, rs.StatusCode, string(body))
+	case target != nil:
+		if err := json.Unmarshal(body, target); err != nil {
+			return fmt.Errorf("unable to decode %v response. %w", desc, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package gla_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/comradequinn/gen/gemini/internal/resource"
+	"github.com/comradequinn/gen/gemini/internal/resource/gla"
+	"github.com/comradequinn/gen/gemini/internal/retry"
+	"github.com/comradequinn/gen/log"
+)
+
+func TestMain(m *testing.M) {
+	log.Init(false, func(string, ...any) {})
+	os.Exit(m.Run())
+}
+
+func TestUploadResumes(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), (resource.ChunkGranularity*3+100)/16)
+
+	var (
+		received []byte
+		chunks   int
+		queries  int
+		dropped  bool
+	)
+
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("X-Goog-Upload-Command") {
+		case "start":
+			rq := struct {
+				File struct {
+					DisplayName string `json:"display_name"`
+				} `json:"file"`
+			}{}
+
+			if err := json.NewDecoder(r.Body).Decode(&rq); err != nil || rq.File.DisplayName != resource.ObjectPrefix+`file "1".txt` {
+				t.Fatalf("expected start request to hold the escaped display name. got %+v, %v", rq, err)
+			}
+
+			w.Header().Set("X-Goog-Upload-Url", "http://"+r.Host+"/upload")
+		case "query":
+			queries++
+			w.Header().Set("X-Goog-Upload-Status", "active")
+			w.Header().Set("X-Goog-Upload-Size-Received", strconv.Itoa(len(received)))
+		case "upload", "upload, finalize":
+			chunks++
+
+			if offset := r.Header.Get("X-Goog-Upload-Offset"); offset != strconv.Itoa(len(received)) {
+				t.Fatalf("expected chunk at offset %v. got %v", len(received), offset)
+			}
+
+			body, _ := io.ReadAll(r.Body)
+
+			if chunks == 2 && !dropped { // receive part of the second chunk, then drop the connection
+				dropped, received = true, append(received, body[:resource.ChunkGranularity/2]...)
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				conn.Close()
+				return
+			}
+
+			received = append(received, body...)
+
+			if r.Header.Get("X-Goog-Upload-Command") == "upload" {
+				w.Header().Set("X-Goog-Upload-Status", "active")
+				return
+			}
+
+			w.Header().Set("X-Goog-Upload-Status", "final")
+			fmt.Fprintf(w, `{"file":{"mimeType":"text/plain","uri":"test-uri"}}`)
+		default:
+			t.Fatalf("unexpected upload command %q", r.Header.Get("X-Goog-Upload-Command"))
+		}
+	}))
+
+	defer svr.Close()
+
+	source, _ := resource.ReaderSource(`file "1".txt`, "text/plain", bytes.NewReader(data))
+
+	ref, err := gla.Upload(context.Background(), resource.UploadRequest{
+		URL:        svr.URL + "/start?key={api-key}",
+		Credential: "test-key",
+		HTTPClient: svr.Client(),
+		Retry:      retry.Policy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+		ChunkSize:  resource.ChunkGranularity,
+		Source:     source,
+	})
+
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if ref.URI != "test-uri" {
+		t.Fatalf("expected uri of test-uri, got %v", ref.URI)
+	}
+
+	if queries != 1 {
+		t.Fatalf("expected upload status to be queried once after the dropped connection. got %v queries", queries)
+	}
+
+	if !bytes.Equal(received, data) {
+		t.Fatalf("expected server to receive all %v bytes of data once. got %v bytes", len(data), len(received))
+	}
+}
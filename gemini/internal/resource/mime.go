@@ -0,0 +1,179 @@
+package resource
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	binarySniffLen  = 8000
+	octetStreamType = "application/octet-stream"
+)
+
+var (
+	// mimeTypes maps file extensions to the mime types of file types supported by gemini
+	mimeTypes = map[string]string{
+		".jpg":      "image/jpeg",
+		".jpeg":     "image/jpeg",
+		".png":      "image/png",
+		".gif":      "image/gif",
+		".bmp":      "image/bmp",
+		".webp":     "image/webp",
+		".heic":     "image/heic",
+		".heif":     "image/heif",
+		".svg":      "image/svg+xml",
+		".tif":      "image/tiff",
+		".tiff":     "image/tiff",
+		".ico":      "image/x-icon",
+		".pdf":      "application/pdf",
+		".mp3":      "audio/mpeg",
+		".wav":      "audio/wav",
+		".aac":      "audio/aac",
+		".ogg":      "audio/ogg",
+		".flac":     "audio/flac",
+		".aif":      "audio/aiff",
+		".aiff":     "audio/aiff",
+		".m4a":      "audio/mp4",
+		".mp4":      "video/mp4",
+		".mpeg":     "video/mpeg",
+		".mpg":      "video/mpg",
+		".mov":      "video/mov",
+		".avi":      "video/avi",
+		".flv":      "video/x-flv",
+		".webm":     "video/webm",
+		".wmv":      "video/wmv",
+		".3gp":      "video/3gpp",
+		".txt":      "text/plain",
+		".md":       "text/markdown",
+		".markdown": "text/markdown",
+		".csv":      "text/csv",
+		".html":     "text/html",
+		".htm":      "text/html",
+		".css":      "text/css",
+		".xml":      "text/xml",
+		".rtf":      "text/rtf",
+		".js":       "text/javascript",
+		".ts":       "text/x-typescript",
+		".py":       "text/x-python",
+		".json":     "application/json",
+	}
+	// unsupportedMIMETypes maps file extensions to the mime types of common file types not supported by gemini, so they can be identified in errors
+	unsupportedMIMETypes = map[string]string{
+		".doc":  "application/msword",
+		".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		".xls":  "application/vnd.ms-excel",
+		".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		".ppt":  "application/vnd.ms-powerpoint",
+		".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+		".odt":  "application/vnd.oasis.opendocument.text",
+		".zip":  "application/zip",
+		".gz":   "application/gzip",
+		".tar":  "application/x-tar",
+		".jar":  "application/java-archive",
+		".exe":  "application/vnd.microsoft.portable-executable",
+		".so":   octetStreamType,
+		".bin":  octetStreamType,
+	}
+	// sniffedAliases maps mime types reported by content sniffing to the equivalent types supported by gemini
+	sniffedAliases = map[string]string{
+		"audio/wave":      "audio/wav",
+		"application/ogg": "audio/ogg",
+	}
+	supportedMIMETypes = func() map[string]bool {
+		supported := map[string]bool{}
+
+		for _, t := range mimeTypes {
+			supported[t] = true
+		}
+
+		return supported
+	}()
+	mimeTypeSuffix = regexp.MustCompile(`^(.+):((?:application|audio|image|text|video)/[a-zA-Z0-9.+\-]+)$`)
+)
+
+// SplitMIMEType separates a path of the form 'path:type/subtype' into the path and the mime type specified to override detection.
+// where no mime type is specified, the path is returned unchanged with an empty mime type
+func SplitMIMEType(p string) (string, string) {
+	if m := mimeTypeSuffix.FindStringSubmatch(p); m != nil {
+		return m[1], m[2]
+	}
+
+	return p, ""
+}
+
+// detectMIMEType returns the mime type of the file based on its extension and its content. text types, and files with no known
+// extension, are verified by sniffing their content so binaries are not mislabelled as text. an error is returned where the type
+// is not supported by gemini
+func detectMIMEType(file string) (string, error) {
+	return detectMIMETypeOf(file, func() (io.ReadCloser, error) { return FileIO.Open(file) })
+}
+
+// detectMIMETypeOf returns the mime type of the named data, as detectMIMEType, reading the data to sniff from open
+func detectMIMETypeOf(file string, open func() (io.ReadCloser, error)) (string, error) {
+	ext := strings.ToLower(filepath.Ext(file))
+
+	if t, ok := unsupportedMIMETypes[ext]; ok {
+		return "", unsupportedTypeError(file, t)
+	}
+
+	contentType := mimeTypes[ext]
+
+	if contentType == "" || strings.HasPrefix(contentType, "text/") {
+		sniffed, err := sniffMIMEType(file, open)
+
+		if err != nil {
+			return "", err
+		}
+
+		if contentType == "" || sniffed == octetStreamType {
+			contentType = sniffed
+		}
+	}
+
+	if !supportedMIMETypes[contentType] {
+		return "", unsupportedTypeError(file, contentType)
+	}
+
+	return contentType, nil
+}
+
+// sniffMIMEType returns the mime type of the file based on its content, treating text as text/plain unless it is a more specific type
+// supported by gemini, such as html
+func sniffMIMEType(file string, open func() (io.ReadCloser, error)) (string, error) {
+	f, err := open()
+
+	if err != nil {
+		return "", fmt.Errorf("unable to open file '%v' to detect its type. %w", file, err)
+	}
+
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, binarySniffLen))
+
+	if err != nil {
+		return "", fmt.Errorf("unable to read file '%v' to detect its type. %w", file, err)
+	}
+
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+
+	switch {
+	case strings.HasPrefix(contentType, "text/") && bytes.IndexByte(data, 0) >= 0: // detection only considers the first 512 bytes
+		return octetStreamType, nil
+	case strings.HasPrefix(contentType, "text/") && !supportedMIMETypes[contentType]:
+		return "text/plain", nil
+	case sniffedAliases[contentType] != "":
+		return sniffedAliases[contentType], nil
+	default:
+		return contentType, nil
+	}
+}
+
+func unsupportedTypeError(file, contentType string) error {
+	return fmt.Errorf("unsupported file type '%v' for file '%v'. to attach it regardless, specify a supported mime type as '%v:{mime-type}'", contentType, file, file)
+}
@@ -0,0 +1,84 @@
+package resource_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/comradequinn/gen/gemini/internal/resource"
+)
+
+func TestFileInfoMIMEType(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name         string
+		file         string
+		content      string
+		override     string
+		expectedType string
+		expectedErr  string
+	}{
+		{name: "csv extension", file: "data.csv", content: "a,b\n1,2\n", expectedType: "text/csv"},
+		{name: "json extension", file: "data.json", content: `{"a":1}`, expectedType: "application/json"},
+		{name: "audio extension", file: "clip.mp3", content: "ID3", expectedType: "audio/mpeg"},
+		{name: "source code", file: "main.go", content: "package main", expectedType: "text/plain"},
+		{name: "extensionless text", file: "Makefile", content: "build:\n\tgo build", expectedType: "text/plain"},
+		{name: "extensionless html", file: "page", content: "<!DOCTYPE html><html></html>", expectedType: "text/html"},
+		{name: "extensionless png", file: "image", content: "\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR", expectedType: "image/png"},
+		{name: "extensionless binary", file: "program", content: "\x7fELF\x02\x01\x01\x00", expectedErr: "unsupported file type 'application/octet-stream'"},
+		{name: "text extension with binary content", file: "notes.txt", content: strings.Repeat("a", 1024) + "\x00", expectedErr: "unsupported file type 'application/octet-stream'"},
+		{name: "unsupported document", file: "report.docx", content: "PK\x03\x04", expectedErr: "unsupported file type 'application/vnd.openxmlformats-officedocument.wordprocessingml.document'"},
+		{name: "override", file: "program.bin", content: "\x7fELF\x02\x01\x01\x00", override: "application/octet-stream", expectedType: "application/octet-stream"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := filepath.Join(dir, test.file)
+
+			if err := os.WriteFile(file, []byte(test.content), 0644); err != nil {
+				t.Fatalf("unable to create test file. %v", err)
+			}
+
+			if test.override != "" {
+				file += ":" + test.override
+			}
+
+			_, contentType, err := resource.FileInfo(file)
+
+			if test.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+					t.Fatalf("expected error containing %q, got %v", test.expectedErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			if contentType != test.expectedType {
+				t.Fatalf("expected mime type %v, got %v", test.expectedType, contentType)
+			}
+		})
+	}
+}
+
+func TestSplitMIMEType(t *testing.T) {
+	tests := []struct {
+		path, expectedPath, expectedType string
+	}{
+		{path: "data.bin:application/octet-stream", expectedPath: "data.bin", expectedType: "application/octet-stream"},
+		{path: "dir/file.txt", expectedPath: "dir/file.txt"},
+		{path: "dir:name/file.txt", expectedPath: "dir:name/file.txt"},
+		{path: "**/*.log:text/plain", expectedPath: "**/*.log", expectedType: "text/plain"},
+	}
+
+	for _, test := range tests {
+		if p, mimeType := resource.SplitMIMEType(test.path); p != test.expectedPath || mimeType != test.expectedType {
+			t.Fatalf("expected %q to split into %q and %q, got %q and %q", test.path, test.expectedPath, test.expectedType, p, mimeType)
+		}
+	}
+}
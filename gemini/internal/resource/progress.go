@@ -0,0 +1,112 @@
+package resource
+
+import (
+	"io"
+	"sync"
+)
+
+type (
+	// Progress describes the state of a batch upload at the point a file's progress changed
+	Progress struct {
+		File       string // the label of the file whose progress changed
+		FileBytes  int64
+		FileSize   int64
+		Files      int // the number of files whose upload has completed
+		TotalFiles int
+		Bytes      int64
+		TotalBytes int64
+	}
+	// ProgressFunc receives upload progress. it is called from the goroutines performing uploads, so must be safe for concurrent use
+	ProgressFunc func(progress Progress)
+	// progressTracker aggregates the progress of each upload in a batch
+	progressTracker struct {
+		mu         sync.Mutex
+		sources    []Source
+		bytes      []int64
+		files      int
+		totalBytes int64
+		notify     ProgressFunc
+	}
+	progressReader struct {
+		io.ReadCloser
+		read func(n int)
+	}
+)
+
+func newProgressTracker(sources []Source, notify ProgressFunc) *progressTracker {
+	p := &progressTracker{sources: sources, bytes: make([]int64, len(sources)), notify: notify}
+
+	for _, s := range sources {
+		p.totalBytes += s.Size
+	}
+
+	return p
+}
+
+// track returns a copy of the source that reports the bytes read from it. progress restarts each time the source is opened, as
+// happens when an upload is retried
+func (p *progressTracker) track(i int, source Source) Source {
+	if p.notify == nil {
+		return source
+	}
+
+	open := source.Open
+
+	source.Open = func() (io.ReadCloser, error) {
+		r, err := open()
+
+		if err != nil {
+			return nil, err
+		}
+
+		p.update(i, func() { p.bytes[i] = 0 })
+
+		return progressReader{ReadCloser: r, read: func(n int) { p.update(i, func() { p.bytes[i] += int64(n) }) }}, nil
+	}
+
+	return source
+}
+
+// complete records that the upload of the specified source has finished
+func (p *progressTracker) complete(i int) {
+	p.update(i, func() {
+		p.bytes[i] = p.sources[i].Size
+		p.files++
+	})
+}
+
+func (p *progressTracker) update(i int, change func()) {
+	if p.notify == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	change()
+
+	progress := Progress{
+		File:       p.sources[i].Label,
+		FileBytes:  p.bytes[i],
+		FileSize:   p.sources[i].Size,
+		Files:      p.files,
+		TotalFiles: len(p.sources),
+		TotalBytes: p.totalBytes,
+	}
+
+	for _, b := range p.bytes {
+		progress.Bytes += b
+	}
+
+	p.notify(progress)
+}
+
+func (r progressReader) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+
+	if n > 0 {
+		r.read(n)
+	}
+
+	return n, err
+}
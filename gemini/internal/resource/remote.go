@@ -0,0 +1,149 @@
+package resource
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/comradequinn/gen/gemini/internal/retry"
+	"github.com/comradequinn/gen/log"
+)
+
+type (
+	// URLRequest defines a remote file to fetch so it can be attached to a prompt
+	URLRequest struct {
+		URL        string // the url of the file, optionally suffixed with ':{mime-type}' to override the detected type
+		HTTPClient *http.Client
+		Retry      retry.Policy
+		MaxSize    int64 // the maximum size of the file. zero indicates no limit
+	}
+)
+
+// IsRemote returns whether the path identifies a remote file, by either an http(s) url or a gs:// uri, rather than a local one
+func IsRemote(p string) bool {
+	return IsURL(p) || IsGCSURI(p)
+}
+
+// IsURL returns whether the path is an http(s) url
+func IsURL(p string) bool {
+	return strings.HasPrefix(p, "https://") || strings.HasPrefix(p, "http://")
+}
+
+// IsGCSURI returns whether the path is a cloud storage gs:// uri
+func IsGCSURI(p string) bool {
+	return strings.HasPrefix(p, "gs://")
+}
+
+// GCSReference returns a reference to an existing cloud storage object, so it can be attached without being downloaded and uploaded
+// again. the mime type is determined from any ':{mime-type}' suffix or otherwise the object's extension
+func GCSReference(uri string) (Reference, error) {
+	uri, contentType := SplitMIMEType(uri)
+
+	bucket, object, _ := strings.Cut(strings.TrimPrefix(uri, "gs://"), "/")
+
+	if bucket == "" || object == "" {
+		return Reference{}, fmt.Errorf("invalid cloud storage uri '%v'. expected gs://{bucket}/{object}", uri)
+	}
+
+	if contentType == "" {
+		if contentType = mimeTypes[strings.ToLower(path.Ext(object))]; contentType == "" {
+			return Reference{}, fmt.Errorf("unable to determine the type of '%v' from its extension. specify its mime type as '%v:{mime-type}'", uri, uri)
+		}
+	}
+
+	return Reference{
+		URI:      uri,
+		MIMEType: contentType,
+		Label:    path.Base(object),
+	}, nil
+}
+
+// URLSource fetches the file at the url and returns a source that holds its data in memory. the mime type is taken from any
+// ':{mime-type}' suffix, otherwise from the response content-type where it is a specific, supported type, or else is detected from the url path
+// and the file content
+func URLSource(ctx context.Context, urlRequest URLRequest) (Source, error) {
+	rawURL, contentType := SplitMIMEType(urlRequest.URL)
+
+	u, err := url.Parse(rawURL)
+
+	if err != nil {
+		return Source{}, fmt.Errorf("invalid url '%v'. %w", rawURL, err)
+	}
+
+	rs, err := urlRequest.Retry.Do(ctx, "fetch-url", func() (*http.Response, error) {
+		rq, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+
+		if err != nil {
+			return nil, retry.Permanent(fmt.Errorf("unable to create fetch-url request. %w", err))
+		}
+
+		log.DebugPrintf("sending fetch url request", "type", "fetch_url_request", "url", rawURL)
+
+		return urlRequest.HTTPClient.Do(rq)
+	})
+
+	if err != nil {
+		return Source{}, fmt.Errorf("unable to fetch '%v'. %w", rawURL, err)
+	}
+
+	defer rs.Body.Close()
+
+	log.DebugPrintf("received fetch url response", "type", "fetch_url_response", "url", rawURL, "status", rs.Status, "content_type", rs.Header.Get("Content-Type"), "content_length", rs.ContentLength)
+
+	if rs.StatusCode != http.StatusOK {
+		return Source{}, fmt.Errorf("unable to fetch '%v'. request failed with status code %v", rawURL, rs.StatusCode)
+	}
+
+	exceeded := func() error {
+		return fmt.Errorf("unable to fetch '%v'. the file exceeds the maximum size of %v bytes", rawURL, urlRequest.MaxSize)
+	}
+
+	if urlRequest.MaxSize > 0 && rs.ContentLength > urlRequest.MaxSize {
+		return Source{}, exceeded()
+	}
+
+	body := io.Reader(rs.Body)
+
+	if urlRequest.MaxSize > 0 {
+		body = io.LimitReader(rs.Body, urlRequest.MaxSize+1) // read one byte beyond the limit to detect that it was exceeded
+	}
+
+	data, err := io.ReadAll(body)
+
+	if err != nil {
+		return Source{}, fmt.Errorf("unable to read '%v'. %w", rawURL, err)
+	}
+
+	if urlRequest.MaxSize > 0 && int64(len(data)) > urlRequest.MaxSize {
+		return Source{}, exceeded()
+	}
+
+	open := func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(data)), nil }
+
+	if contentType == "" {
+		if headerType, _, err := mime.ParseMediaType(rs.Header.Get("Content-Type")); err == nil && supportedMIMETypes[headerType] && headerType != "text/plain" { // text/plain is a common default, so is not specific enough to rely on
+			contentType = headerType
+		} else if contentType, err = detectMIMETypeOf(u.Scheme+"://"+u.Host+u.Path, open); err != nil { // exclude any query string from the extension
+			return Source{}, err
+		}
+	}
+
+	label := path.Base(u.Path)
+
+	if label == "/" || label == "." {
+		label = u.Host
+	}
+
+	return Source{
+		Label:    label,
+		MIMEType: contentType,
+		Size:     int64(len(data)),
+		Open:     open,
+	}, nil
+}
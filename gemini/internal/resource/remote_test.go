@@ -0,0 +1,104 @@
+package resource_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/comradequinn/gen/gemini/internal/resource"
+)
+
+func TestURLSource(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/report":
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Write([]byte("%PDF-1.7"))
+		case "/data.csv":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte("a,b\n1,2\n"))
+		case "/program":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte("\x7fELF\x02\x01\x01\x00"))
+		case "/large.txt":
+			w.Write([]byte(strings.Repeat("x", 64)))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer svr.Close()
+
+	tests := []struct {
+		name         string
+		url          string
+		expectedType string
+		expectedData string
+		expectedErr  string
+	}{
+		{name: "supported content type header", url: svr.URL + "/report", expectedType: "application/pdf", expectedData: "%PDF-1.7"},
+		{name: "generic content type header", url: svr.URL + "/data.csv?version=2", expectedType: "text/csv", expectedData: "a,b\n1,2\n"},
+		{name: "unsupported binary", url: svr.URL + "/program", expectedErr: "unsupported file type 'application/octet-stream'"},
+		{name: "override", url: svr.URL + "/program:application/octet-stream", expectedType: "application/octet-stream", expectedData: "\x7fELF\x02\x01\x01\x00"},
+		{name: "size limit exceeded", url: svr.URL + "/large.txt", expectedErr: "exceeds the maximum size of 32 bytes"},
+		{name: "not found", url: svr.URL + "/missing", expectedErr: "status code 404"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source, err := resource.URLSource(context.Background(), resource.URLRequest{
+				URL:        test.url,
+				HTTPClient: svr.Client(),
+				MaxSize:    32,
+			})
+
+			if test.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+					t.Fatalf("expected error containing %q, got %v", test.expectedErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			r, _ := source.Open()
+			data, _ := io.ReadAll(r)
+
+			if source.MIMEType != test.expectedType || string(data) != test.expectedData || source.Size != int64(len(test.expectedData)) {
+				t.Fatalf("expected %v data %q, got %v data %q of size %v", test.expectedType, test.expectedData, source.MIMEType, data, source.Size)
+			}
+		})
+	}
+}
+
+func TestGCSReference(t *testing.T) {
+	tests := []struct {
+		uri, expectedURI, expectedType, expectedErr string
+	}{
+		{uri: "gs://bucket/build/report.pdf", expectedURI: "gs://bucket/build/report.pdf", expectedType: "application/pdf"},
+		{uri: "gs://bucket/build/output:text/plain", expectedURI: "gs://bucket/build/output", expectedType: "text/plain"},
+		{uri: "gs://bucket/build/output", expectedErr: "unable to determine the type"},
+		{uri: "gs://bucket", expectedErr: "invalid cloud storage uri"},
+	}
+
+	for _, test := range tests {
+		ref, err := resource.GCSReference(test.uri)
+
+		if test.expectedErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+				t.Fatalf("expected error containing %q for %v, got %v", test.expectedErr, test.uri, err)
+			}
+
+			continue
+		}
+
+		if err != nil || ref.URI != test.expectedURI || ref.MIMEType != test.expectedType {
+			t.Fatalf("expected %v reference of type %v for %v, got %+v and error %v", test.expectedURI, test.expectedType, test.uri, ref, err)
+		}
+	}
+}
@@ -1,36 +1,77 @@
 package resource
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
+	"net/http"
+	"net/url"
 	"os"
-	"path/filepath"
-	"sync"
+	"strings"
+	"time"
 
+	"github.com/comradequinn/gen/gemini/internal/retry"
 	"github.com/comradequinn/gen/log"
+	"golang.org/x/sync/errgroup"
 )
 
 type (
 	BatchUploadRequest struct {
-		URL        string
-		Credential string
-		UploadFunc UploadFunc
-		Files      []string
+		URL          string
+		Credential   string
+		HTTPClient   *http.Client
+		UploadFunc   UploadFunc
+		Retry        retry.Policy
+		Cache        *Cache       // optional. when specified, data previously uploaded is reused rather than uploaded again
+		Concurrency  int          // the maximum number of concurrent uploads. values less than 1 are treated as 1
+		ProgressFunc ProgressFunc // optional. called as data is read for upload and as each upload completes
+		ChunkSize    int64        // the size of the chunks that data is uploaded in. values less than 1 result in the default chunk size
+		Sources      []Source
 	}
 	UploadRequest struct {
 		URL        string
 		Credential string
-		File       string
+		HTTPClient *http.Client
+		Retry      retry.Policy
+		ChunkSize  int64
+		Source     Source
+	}
+	// Source defines data to upload. open may be called more than once, such as when an upload is retried, and must return the data from its start each time
+	Source struct {
+		Label    string
+		MIMEType string
+		Size     int64
+		Open     func() (io.ReadCloser, error)
 	}
 	Reference struct {
 		URI      string
 		MIMEType string
 		Label    string
+		Expires  time.Time // the zero value indicates the reference does not expire
+		Data     []byte    // where set, the data is included inline in requests rather than referenced by its uri
+	}
+	UploadFunc func(ctx context.Context, uploadRequest UploadRequest) (Reference, error)
+	// FileRequest defines the location of, and the means of accessing, uploaded files that are to be listed or deleted
+	FileRequest struct {
+		URL        string
+		Credential string
+		HTTPClient *http.Client
+		Retry      retry.Policy
+	}
+	// Object describes an uploaded file
+	Object struct {
+		URI     string
+		Name    string
+		Created time.Time
 	}
-	UploadFunc func(uploadRequest UploadRequest) (Reference, error)
+	ListFunc   func(ctx context.Context, fileRequest FileRequest) ([]Object, error)
+	DeleteFunc func(ctx context.Context, fileRequest FileRequest, uri string) error
 )
 
+// ObjectPrefix is the prefix of the names given to uploaded files, which identifies them as having been uploaded by gen
+const ObjectPrefix = "gen-attachment-"
+
 var (
 	FileIO = struct {
 		Stat func(name string) (os.FileInfo, error)
@@ -39,122 +80,188 @@ var (
 		Stat: os.Stat,
 		Open: func(name string) (io.ReadCloser, error) { return os.Open(name) },
 	}
-	mimeTypes = map[string]string{
-		".jpg":  "image/jpeg",
-		".jpeg": "image/jpeg",
-		".png":  "image/png",
-		".gif":  "image/gif",
-		".bmp":  "image/bmp",
-		".webp": "image/webp",
-		".svg":  "image/svg+xml",
-		".tif":  "image/tiff",
-		".tiff": "image/tiff",
-		".ico":  "image/x-icon",
-		".pdf":  "application/pdf",
-	}
 )
 
-func Upload(batchUploadRequest BatchUploadRequest) ([]Reference, error) {
-	type response struct {
-		resourceRef Reference
-		err         error
-	}
-
-	responses, uploadWorkers := make(chan response, 1), sync.WaitGroup{}
-	ctx, ctxCancelFunc := context.WithCancel(context.Background())
+// Upload uploads the sources using a pool of workers, returning their references in the same order as the sources. where an upload fails,
+// outstanding uploads are cancelled and the error is returned
+func Upload(ctx context.Context, batchUploadRequest BatchUploadRequest) ([]Reference, error) {
+	var (
+		resourceRefs = make([]Reference, len(batchUploadRequest.Sources))
+		progress     = newProgressTracker(batchUploadRequest.Sources, batchUploadRequest.ProgressFunc)
+		g, gCtx      = errgroup.WithContext(ctx)
+	)
 
-	uploadWorkers.Add(len(batchUploadRequest.Files)) // add an extra value to the counter for the routine that dequeues the responses
+	g.SetLimit(max(batchUploadRequest.Concurrency, 1))
 
-	for _, f := range batchUploadRequest.Files {
-		go func(f string) { // upload files concurrently
+	for i, s := range batchUploadRequest.Sources {
+		g.Go(func() (err error) { // upload files concurrently, within the concurrency limit
 			defer func() {
-				uploadWorkers.Done()
-
-				if err := recover(); err != nil {
-					responses <- response{err: fmt.Errorf("panic in file upload func for file '%v'. %v", f, err)}
+				if r := recover(); r != nil {
+					err = fmt.Errorf("panic in file upload func for file '%v'. %v", s.Label, r)
 				}
 			}()
 
-			log.DebugPrintf("started file upload worker", "type", "batch_upload_request", "file", f)
-
 			select {
-			case <-ctx.Done():
-				log.DebugPrintf("file upload context cancelled", "type", "batch_upload_request", "file", f)
-				return
+			case <-gCtx.Done():
+				log.DebugPrintf("file upload context cancelled", "type", "batch_upload_request", "file", s.Label)
+				return gCtx.Err()
 			default:
 			}
 
-			resourceRef, err := batchUploadRequest.UploadFunc(UploadRequest{
+			log.DebugPrintf("started file upload", "type", "batch_upload_request", "file", s.Label)
+
+			cacheKey := ""
+
+			if cache := batchUploadRequest.Cache; cache != nil {
+				var err error
+
+				if cacheKey, err = cache.key(s); err != nil {
+					return fmt.Errorf("unable to upload file '%v'. %w", s.Label, err)
+				}
+
+				if resourceRef, ok := cache.get(cacheKey); ok {
+					log.DebugPrintf("reusing cached file upload", "type", "batch_upload_request", "file", s.Label, "uri", resourceRef.URI)
+					resourceRef.Label = s.Label
+					resourceRefs[i] = resourceRef
+					progress.complete(i)
+					return nil
+				}
+			}
+
+			resourceRef, err := batchUploadRequest.UploadFunc(gCtx, UploadRequest{
 				URL:        batchUploadRequest.URL,
 				Credential: batchUploadRequest.Credential,
-				File:       f,
+				HTTPClient: batchUploadRequest.HTTPClient,
+				Retry:      batchUploadRequest.Retry,
+				ChunkSize:  batchUploadRequest.ChunkSize,
+				Source:     progress.track(i, s),
 			})
 
 			if err != nil {
-				responses <- response{err: fmt.Errorf("unable to upload file '%v' via file storage api. %w", f, err)}
-				return
+				log.DebugPrintf("file upload error. cancelling outstanding uploads", "type", "batch_upload_response", "file", s.Label, "err", err)
+				return fmt.Errorf("unable to upload file '%v' via file storage api. %w", s.Label, err)
+			}
+
+			if batchUploadRequest.Cache != nil {
+				batchUploadRequest.Cache.put(cacheKey, resourceRef)
 			}
 
-			responses <- response{resourceRef: resourceRef}
-			log.DebugPrintf("stopped file upload worker", "type", "batch_upload_request", "file", f)
-		}(f)
+			resourceRefs[i] = resourceRef
+			progress.complete(i)
+
+			log.DebugPrintf("completed file upload", "type", "batch_upload_response", "file", s.Label)
+
+			return nil
+		})
 	}
 
-	var (
-		err          error
-		resourceRefs = make([]Reference, 0, len(batchUploadRequest.Files))
-	)
+	err := g.Wait()
 
-	responseWorkerDone := make(chan struct{}, 1)
+	if batchUploadRequest.Cache != nil {
+		if err := batchUploadRequest.Cache.save(); err != nil { // failing to cache uploads only affects subsequent requests, so is not an error
+			log.DebugPrintf("unable to save upload cache", "type", "batch_upload_response", "err", err)
+		}
+	}
 
-	go func() {
-		defer func() { responseWorkerDone <- struct{}{} }()
+	if err != nil {
+		return nil, fmt.Errorf("unable to upload files to storage provider. %w", err)
+	}
 
-		log.DebugPrintf("started file upload response processing worker", "type", "batch_upload_response")
+	return resourceRefs, nil
+}
 
-		for response := range responses {
-			log.DebugPrintf("processing file upload response", "type", "batch_upload_response", "file", response.resourceRef.Label, "err", response.err)
+// FileSource returns a source that reads the specified file. the file may be suffixed with ':{mime-type}' to override the detected type
+func FileSource(file string) (Source, error) {
+	fileInfo, contentType, err := FileInfo(file)
+	file, _ = SplitMIMEType(file)
 
-			if err != nil { // once an error has occurred just drain the channel
-				continue
-			}
+	if err != nil {
+		return Source{}, err
+	}
 
-			if response.err != nil { // an error occurred...
-				log.DebugPrintf("file upload response error. terminating workers", "type", "batch_upload_response", "err", response.err)
-				err = response.err // ... and capture the error
-				ctxCancelFunc()    // ... cancel any outstanding uploads ...
-				continue
-			}
+	return Source{
+		Label:    fileInfo.Name(),
+		MIMEType: contentType,
+		Size:     fileInfo.Size(),
+		Open: func() (io.ReadCloser, error) {
+			f, err := FileIO.Open(file)
 
-			resourceRefs = append(resourceRefs, response.resourceRef)
-		}
+			if err != nil {
+				return nil, fmt.Errorf("unable to open file '%v' for upload. %w", file, err)
+			}
 
-		log.DebugPrintf("stopped file upload response processing worker", "type", "batch_upload_response")
-	}()
+			return f, nil
+		},
+	}, nil
+}
 
-	uploadWorkers.Wait() // wait until all files have been uploaded
-	close(responses)     // close the channel to terminate the response processing routine
-	<-responseWorkerDone // wait until the response processing routine ends
+// ReaderSource returns a source that holds the data read from the reader in memory, so it can be read more than once
+func ReaderSource(label, mimeType string, reader io.Reader) (Source, error) {
+	data, err := io.ReadAll(reader)
 
 	if err != nil {
-		return nil, fmt.Errorf("unable to upload files to storage provider. %w", err)
+		return Source{}, fmt.Errorf("unable to read data for '%v'. %w", label, err)
 	}
 
-	return resourceRefs, nil
+	return Source{
+		Label:    label,
+		MIMEType: mimeType,
+		Size:     int64(len(data)),
+		Open:     func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(data)), nil },
+	}, nil
 }
 
-func FileInfo(file string) (os.FileInfo, string, error) {
-	contentType := mimeTypes[filepath.Ext(file)]
+// ObjectURL returns the url of the uploaded file with the specified id, given the url used to list uploaded files.
+// the id is escaped and added as the final path segment, ahead of any query string
+func ObjectURL(listURL, id string) string {
+	base, query, found := strings.Cut(listURL, "?")
 
-	if contentType == "" {
-		contentType = "text/plain"
+	if found {
+		query = "?" + query
+	}
+
+	return strings.TrimSuffix(base, "/") + "/" + url.PathEscape(id) + query
+}
+
+// Inline returns a reference that holds the data of the source itself, for inclusion directly in a request rather than being uploaded
+func Inline(source Source) (Reference, error) {
+	r, err := source.Open()
+
+	if err != nil {
+		return Reference{}, err
+	}
+
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+
+	if err != nil {
+		return Reference{}, fmt.Errorf("unable to read '%v'. %w", source.Label, err)
 	}
 
+	return Reference{
+		MIMEType: source.MIMEType,
+		Label:    source.Label,
+		Data:     data,
+	}, nil
+}
+
+// FileInfo returns the file info and mime type of the file. where the file is suffixed with ':{mime-type}', that type is returned,
+// otherwise the type is detected from the file extension and content. an error is returned if the detected type is not supported
+func FileInfo(file string) (os.FileInfo, string, error) {
+	file, contentType := SplitMIMEType(file)
+
 	fileInfo, err := FileIO.Stat(file)
 
 	if err != nil {
 		return nil, "", fmt.Errorf("invalid filepath. '%v' file does not exist. %w", file, err)
 	}
 
+	if contentType == "" {
+		if contentType, err = detectMIMEType(file); err != nil {
+			return nil, "", err
+		}
+	}
+
 	return fileInfo, contentType, nil
 }
@@ -0,0 +1,85 @@
+package resource_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/comradequinn/gen/gemini/internal/resource"
+)
+
+func TestUpload(t *testing.T) {
+	const concurrency = 3
+
+	var (
+		sources           = []resource.Source{}
+		active, maxActive atomic.Int64
+		mu                sync.Mutex
+		progress          = []resource.Progress{}
+	)
+
+	for i := range 10 {
+		source, _ := resource.ReaderSource(fmt.Sprintf("file-%v", i), "text/plain", strings.NewReader(strings.Repeat("x", i+1)))
+		sources = append(sources, source)
+	}
+
+	refs, err := resource.Upload(context.Background(), resource.BatchUploadRequest{
+		Concurrency: concurrency,
+		UploadFunc: func(ctx context.Context, uploadRequest resource.UploadRequest) (resource.Reference, error) {
+			n := active.Add(1)
+			defer active.Add(-1)
+
+			for m := maxActive.Load(); n > m && !maxActive.CompareAndSwap(m, n); m = maxActive.Load() {
+			}
+
+			r, _ := uploadRequest.Source.Open()
+			defer r.Close()
+
+			if _, err := io.ReadAll(r); err != nil {
+				return resource.Reference{}, err
+			}
+
+			time.Sleep(time.Duration(rand.IntN(10)) * time.Millisecond) // complete in a random order
+
+			return resource.Reference{URI: "uri-" + uploadRequest.Source.Label, Label: uploadRequest.Source.Label}, nil
+		},
+		ProgressFunc: func(p resource.Progress) {
+			mu.Lock()
+			defer mu.Unlock()
+			progress = append(progress, p)
+		},
+		Sources: sources,
+	})
+
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for i, ref := range refs {
+		if ref.URI != fmt.Sprintf("uri-file-%v", i) {
+			t.Fatalf("expected references in source order. got %v at index %v", ref.URI, i)
+		}
+	}
+
+	if maxActive.Load() > concurrency {
+		t.Fatalf("expected at most %v concurrent uploads. got %v", concurrency, maxActive.Load())
+	}
+
+	last := progress[len(progress)-1]
+
+	if last.Files != len(sources) || last.TotalFiles != len(sources) || last.Bytes != 55 || last.TotalBytes != 55 {
+		t.Fatalf("expected final progress to report all files and bytes uploaded. got %+v", last)
+	}
+
+	for i := 1; i < len(progress); i++ {
+		if progress[i].Files < progress[i-1].Files {
+			t.Fatalf("expected completed file count to increase monotonically. got %+v", progress)
+		}
+	}
+}
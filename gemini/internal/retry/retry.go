@@ -0,0 +1,154 @@
+// Package retry encapsulates the retrying of failed http requests with exponential backoff
+package retry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/comradequinn/gen/log"
+)
+
+type (
+	// Policy defines how, and how often, failed requests are retried
+	Policy struct {
+		MaxAttempts int
+		BaseDelay   time.Duration
+		Jitter      time.Duration
+		Retries     *atomic.Int64 // optional. incremented each time a request is retried
+	}
+	// SendFunc creates and sends a request. it is invoked once per attempt so must not reuse request bodies
+	SendFunc func() (*http.Response, error)
+	// permanentError wraps an error returned by a SendFunc that should not be retried
+	permanentError struct{ error }
+)
+
+const maxDelay = 5 * time.Minute
+
+// Permanent marks an error returned from a SendFunc as one that retrying would not resolve
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// Do invokes send until it returns a non-retryable result or the maximum number of attempts is reached.
+// responses with status codes of 429 or 5xx, and transport errors, are retried; honouring any delay
+// requested by the server via a Retry-After header or a RetryInfo detail in a gemini error body
+func (p Policy) Do(ctx context.Context, desc string, send SendFunc) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		rs, err := send()
+
+		if ctx.Err() != nil {
+			return rs, err
+		}
+
+		var (
+			requestedDelay time.Duration
+			permanentErr   permanentError
+		)
+
+		switch {
+		case errors.As(err, &permanentErr):
+			return rs, permanentErr.error
+		case err != nil:
+			log.DebugPrintf("request failed", "type", "retry_request_failed", "request", desc, "attempt", attempt, "err", err)
+		case retryable(rs.StatusCode):
+			body, readErr := io.ReadAll(rs.Body)
+			rs.Body.Close()
+			rs.Body = io.NopCloser(bytes.NewReader(body)) // allow the final response to be read by the caller
+
+			if readErr != nil {
+				return rs, fmt.Errorf("unable to read response body. %w", readErr)
+			}
+
+			requestedDelay = serverDelay(rs.Header, body)
+
+			log.DebugPrintf("request returned retryable status", "type", "retry_request_failed", "request", desc, "attempt", attempt, "status", rs.Status, "body", string(body))
+		default:
+			return rs, nil
+		}
+
+		if attempt >= p.MaxAttempts {
+			return rs, err
+		}
+
+		delay := max(p.backoff(attempt), requestedDelay)
+
+		log.DebugPrintf("retrying request", "type", "retry_request", "request", desc, "attempt", attempt, "delay", delay.String())
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return rs, ctx.Err()
+		}
+
+		if rs != nil {
+			rs.Body.Close()
+		}
+
+		if p.Retries != nil {
+			p.Retries.Add(1)
+		}
+	}
+}
+
+func (p Policy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << (attempt - 1)
+
+	if delay <= 0 || delay > maxDelay {
+		delay = maxDelay
+	}
+
+	if p.Jitter > 0 {
+		delay += rand.N(p.Jitter)
+	}
+
+	return delay
+}
+
+func retryable(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+}
+
+// serverDelay returns the delay requested by the server, if any, capped at the maximum delay
+func serverDelay(header http.Header, body []byte) time.Duration {
+	var delay time.Duration
+
+	if retryAfter := header.Get("Retry-After"); retryAfter != "" {
+		if seconds, err := strconv.Atoi(retryAfter); err == nil {
+			delay = time.Duration(seconds) * time.Second
+		} else if t, err := http.ParseTime(retryAfter); err == nil {
+			delay = time.Until(t)
+		}
+	}
+
+	errorBody := struct {
+		Error struct {
+			Details []struct {
+				Type       string `json:"@type"`
+				RetryDelay string `json:"retryDelay"`
+			} `json:"details"`
+		} `json:"error"`
+	}{}
+
+	if err := json.Unmarshal(body, &errorBody); err == nil {
+		for _, detail := range errorBody.Error.Details {
+			if detail.Type != "type.googleapis.com/google.rpc.RetryInfo" {
+				continue
+			}
+
+			if d, err := time.ParseDuration(detail.RetryDelay); err == nil && d > delay {
+				delay = d
+			}
+		}
+	}
+
+	return min(max(delay, 0), maxDelay)
+}
@@ -0,0 +1,116 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/comradequinn/gen/gemini/internal/retry"
+	"github.com/comradequinn/gen/log"
+)
+
+func TestMain(m *testing.M) {
+	log.Init(false, func(string, ...any) {})
+	os.Exit(m.Run())
+}
+
+func TestDo(t *testing.T) {
+	tests := []struct {
+		name            string
+		statusCodes     []int
+		body            string
+		maxAttempts     int
+		expectedStatus  int
+		expectedRetries int64
+		minimumElapsed  time.Duration
+	}{
+		{
+			name:            "success after transient errors",
+			statusCodes:     []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK},
+			maxAttempts:     3,
+			expectedStatus:  http.StatusOK,
+			expectedRetries: 2,
+		},
+		{
+			name:            "max attempts reached",
+			statusCodes:     []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+			maxAttempts:     2,
+			expectedStatus:  http.StatusServiceUnavailable,
+			expectedRetries: 1,
+		},
+		{
+			name:            "non-retryable status",
+			statusCodes:     []int{http.StatusBadRequest, http.StatusOK},
+			maxAttempts:     3,
+			expectedStatus:  http.StatusBadRequest,
+			expectedRetries: 0,
+		},
+		{
+			name:            "retry info honoured",
+			statusCodes:     []int{http.StatusTooManyRequests, http.StatusOK},
+			body:            `{"error":{"code":429,"status":"RESOURCE_EXHAUSTED","details":[{"@type":"type.googleapis.com/google.rpc.RetryInfo","retryDelay":"0.2s"}]}}`,
+			maxAttempts:     3,
+			expectedStatus:  http.StatusOK,
+			expectedRetries: 1,
+			minimumElapsed:  200 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := atomic.Int64{}
+
+			svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.statusCodes[requests.Add(1)-1])
+				fmt.Fprint(w, tt.body)
+			}))
+			defer svr.Close()
+
+			policy := retry.Policy{MaxAttempts: tt.maxAttempts, BaseDelay: time.Millisecond, Retries: &atomic.Int64{}}
+			started := time.Now()
+
+			rs, err := policy.Do(context.Background(), "test", func() (*http.Response, error) { return http.Get(svr.URL) })
+
+			if err != nil {
+				t.Fatalf("expected no error. got %v", err)
+			}
+
+			defer rs.Body.Close()
+
+			if rs.StatusCode != tt.expectedStatus {
+				t.Fatalf("expected status code %v. got %v", tt.expectedStatus, rs.StatusCode)
+			}
+
+			if policy.Retries.Load() != tt.expectedRetries {
+				t.Fatalf("expected %v retries. got %v", tt.expectedRetries, policy.Retries.Load())
+			}
+
+			if elapsed := time.Since(started); elapsed < tt.minimumElapsed {
+				t.Fatalf("expected at least %v to elapse. got %v", tt.minimumElapsed, elapsed)
+			}
+		})
+	}
+}
+
+func TestDoPermanentError(t *testing.T) {
+	attempts, expectedErr := 0, errors.New("test-error")
+
+	_, err := retry.Policy{MaxAttempts: 3}.Do(context.Background(), "test", func() (*http.Response, error) {
+		attempts++
+		return nil, retry.Permanent(expectedErr)
+	})
+
+	if !errors.Is(err, expectedErr) {
+		t.Fatalf("expected error %v. got %v", expectedErr, err)
+	}
+
+	if attempts != 1 {
+		t.Fatalf("expected 1 attempt. got %v", attempts)
+	}
+}
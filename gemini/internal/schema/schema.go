@@ -51,6 +51,7 @@ type (
 	Part struct {
 		Text             string          `json:"text,omitzero"`
 		File             *FileData       `json:"fileData,omitempty"`
+		InlineData       *Blob           `json:"inlineData,omitempty"`
 		FunctionCall     FunctionCall    `json:"functionCall,omitempty,omitzero"`
 		FunctionResponse json.RawMessage `json:"function_response,omitempty,omitzero"`
 	}
@@ -58,6 +59,11 @@ type (
 		MIMEType string `json:"mimeType"`
 		URI      string `json:"fileUri"`
 	}
+	// Blob holds file data included directly in a request. the data is base64 encoded when marshalled
+	Blob struct {
+		MIMEType string `json:"mimeType"`
+		Data     []byte `json:"data"`
+	}
 	FunctionCall struct {
 		Name string          `json:"name"`
 		Args json.RawMessage `json:"args"`
@@ -1,25 +1,38 @@
 package gemini
 
+import "io"
+
 type (
 	Prompt struct {
-		History       []Transaction
-		InputType     InputType
-		Text          string
-		FilePaths     []string
-		ExecuteResult ExecuteResult
-		ReadResult    ReadResult
-		WriteResult   WriteResult
-		Schema        JSONSchema
+		History        []Transaction
+		InputType      InputType
+		Text           string
+		FilePaths      []string // files to attach, as resolved by ExpandFilePaths. directories and patterns are not expanded
+		Attachments    []Attachment
+		FileReferences []FileReference // files already attached to an earlier prompt, such as one being retried, to attach again
+		ExecuteResult  ExecuteResult
+		ReadResult     ReadResult
+		WriteResult    WriteResult
+		Schema         JSONSchema
+	}
+	// Attachment defines data to attach to a prompt that is not read from a file path, such as data piped via stdin
+	Attachment struct {
+		Label    string
+		MIMEType string
+		Reader   io.Reader
 	}
 	FileReference struct {
 		URI      string `json:"uri"`
 		MIMEType string `json:"mimeType"`
 		Label    string `json:"label"`
+		Data     []byte `json:"data,omitempty"` // where no uri is set, the file was included inline in the request rather than uploaded
 	}
 	Transaction struct {
-		Tokens int    `json:"tokens"`
-		Input  Input  `json:"input"`
-		Output Output `json:"output"`
+		Tokens     int    `json:"tokens"`
+		Retries    int    `json:"-"`
+		Summarises int    `json:"summarises,omitempty"` // where the transaction is a summary, the number of transactions at the start of the history it replaces
+		Input      Input  `json:"input"`
+		Output     Output `json:"output"`
 	}
 	Role       string
 	InputType  string
@@ -63,9 +76,13 @@ func (i Input) IsExecuteResult() bool {
 }
 
 func (i Input) IsReadResult() bool {
-	return i.ReadResult.FilesAttached
+	return i.ReadResult.FilesAttached || i.ReadResult.Error != ""
 }
 
 func (i Input) IsWriteResult() bool {
-	return i.WriteResult.Written
+	return i.WriteResult.Written || i.WriteResult.Error != ""
+}
+
+func (i Input) IsSummary() bool {
+	return i.Type == InputTypeSummary
 }
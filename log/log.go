@@ -25,7 +25,7 @@ func Init(debug bool, writer func(string, ...any)) {
 		logLevel = slog.LevelDebug
 	}
 
-	logger = slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel}))
+	logger = slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel, ReplaceAttr: redactAttr}))
 }
 
 // FatalfIf logs an error, prints it to stdout and exits with code
@@ -33,8 +33,9 @@ func FatalfIf(condition bool, format string, v ...any) {
 	if !condition {
 		return
 	}
-	logger.Error("process terminated due to error", "err", fmt.Errorf(format, v...))
-	w(format+"\n", v...)
+	err := fmt.Errorf(format, v...)
+	logger.Error("process terminated due to error", "err", err)
+	w("%v\n", redact(err.Error()))
 	os.Exit(1)
 }
 
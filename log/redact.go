@@ -0,0 +1,123 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const redacted = "[REDACTED]"
+
+var (
+	redaction = struct {
+		sync.RWMutex
+		disabled bool
+		values   []string
+		patterns []*regexp.Regexp
+	}{
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)([?&]key=)[^&\s"'\\]+`),   // api keys in query strings
+			regexp.MustCompile(`(?i)(bearer\s+)[^\s"'\\\]]+`), // bearer tokens in authorization headers
+			regexp.MustCompile(`AIza[0-9A-Za-z_\-]{35}`),      // google api keys
+			regexp.MustCompile(`ya29\.[0-9A-Za-z_\-\.]+`),     // google oauth access tokens
+		},
+	}
+)
+
+// RedactValues registers literal values, such as credentials, to be masked wherever they appear in log output
+func RedactValues(values ...string) {
+	redaction.Lock()
+	defer redaction.Unlock()
+
+	for _, v := range values {
+		if v != "" {
+			redaction.values = append(redaction.values, v)
+		}
+	}
+}
+
+// RedactPatterns registers regular expressions whose matches are to be masked wherever they appear in log output.
+// where a pattern contains a capture group, the text matched by the first group is preserved, so 'token=(\w+)' would
+// not work as intended but '(token=)\w+' would mask only the token itself
+func RedactPatterns(patterns ...string) error {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+
+		if err != nil {
+			return fmt.Errorf("invalid redaction pattern '%v'. %w", p, err)
+		}
+
+		compiled = append(compiled, re)
+	}
+
+	redaction.Lock()
+	defer redaction.Unlock()
+
+	redaction.patterns = append(redaction.patterns, compiled...)
+
+	return nil
+}
+
+// DisableRedaction causes log output to include sensitive values unmasked. it is intended only for local debugging
+func DisableRedaction() {
+	redaction.Lock()
+	defer redaction.Unlock()
+
+	redaction.disabled = true
+}
+
+func redact(s string) string {
+	redaction.RLock()
+	defer redaction.RUnlock()
+
+	if redaction.disabled {
+		return s
+	}
+
+	for _, v := range redaction.values {
+		s = strings.ReplaceAll(s, v, redacted)
+	}
+
+	for _, re := range redaction.patterns {
+		if re.NumSubexp() > 0 { // preserve any leading context, such as 'key=', captured by the first group
+			s = re.ReplaceAllString(s, "${1}"+redacted)
+			continue
+		}
+
+		s = re.ReplaceAllString(s, redacted)
+	}
+
+	return s
+}
+
+// redactAttr is a slog.HandlerOptions.ReplaceAttr func that masks sensitive values in all attributes
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, redact(a.Value.String()))
+	case slog.KindAny:
+		switch v := a.Value.Any().(type) {
+		case error:
+			return slog.String(a.Key, redact(v.Error()))
+		case fmt.Stringer:
+			return slog.String(a.Key, redact(v.String()))
+		default:
+			data, err := json.Marshal(v)
+
+			if err != nil {
+				return slog.String(a.Key, redact(fmt.Sprintf("%+v", v)))
+			}
+
+			if r := redact(string(data)); r != string(data) {
+				return slog.Any(a.Key, json.RawMessage(r))
+			}
+		}
+	}
+
+	return a
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"flag"
 	"os"
+	"os/signal"
+	"path"
 	"strings"
 
 	"github.com/comradequinn/gen/cli"
@@ -27,11 +31,23 @@ func main() {
 		log.FatalfIf(err != nil, "process terminated due to panic. %v", err)
 	}()
 
-	args := cli.ReadArgs(os.Getenv("HOME"), app, gemini.Models.Pro)
+	args, err := cli.ReadArgs(os.Getenv("HOME"), app, gemini.Models.Pro)
 
 	log.Init(args.Debug(), cli.WriteError)
 
+	log.FatalfIf(err != nil, "invalid arguments. %v", err)
+
+	if *args.Unredacted {
+		log.DisableRedaction()
+	}
+
+	if len(*args.RedactPatterns) > 0 {
+		err := log.RedactPatterns(*args.RedactPatterns...)
+		log.FatalfIf(err != nil, "invalid redact argument. %v", err)
+	}
+
 	log.FatalfIf(args.Quiet() && args.ExecutionApproval(), "command approval cannot be enabled in quiet mode")
+	log.FatalfIf(args.Quiet() && args.Interactive(), "interactive mode cannot be enabled in quiet mode")
 
 	apiCredential := args.AccessToken()
 
@@ -39,45 +55,204 @@ func main() {
 		apiCredential = os.Getenv("GEMINI_API_KEY")
 	}
 
+	log.RedactValues(apiCredential)
+
+	model := gemini.Models.Flash
+	switch {
+	case *args.CustomModel != "":
+		model = *args.CustomModel
+	case *args.ProModel:
+		model = gemini.Models.Pro
+	}
+
+	uploadCacheFile := path.Join(*args.AppDir, cli.UploadCacheFileName)
+
+	if *args.DisableUploadCache {
+		uploadCacheFile = ""
+	}
+
+	cfg := gemini.Config{
+		GeminiURL:          *args.CustomURL,
+		Credential:         apiCredential,
+		GCPProject:         args.GCPProject(),
+		GCSBucket:          args.GCSBucket(),
+		Model:              model,
+		FileStorageURL:     *args.CustomUploadURL,
+		SystemPrompt:       *args.SystemPrompt,
+		MaxTokens:          *args.MaxTokens,
+		Temperature:        *args.Temperature,
+		TopP:               *args.TopP,
+		Grounding:          !*args.DisableGrounding,
+		UseCase:            *args.UseCase,
+		ExecutionEnabled:   args.ExecutionEnabled(),
+		ExecutionApproval:  args.ExecutionApproval(),
+		RetryAttempts:      *args.RetryAttempts,
+		RetryDelay:         *args.RetryDelay,
+		RetryJitter:        *args.RetryJitter,
+		HTTPTimeout:        *args.Timeout,
+		HTTPProxy:          *args.Proxy,
+		HTTPCACert:         *args.CACert,
+		MaxFileSize:        *args.MaxFileSize,
+		UploadCacheFile:    uploadCacheFile,
+		InlineMaxSize:      *args.InlineMaxSize,
+		UploadConcurrency:  *args.UploadConcurrency,
+		UploadChunkSize:    *args.UploadChunkSize,
+		ContextBudget:      *args.ContextBudget,
+		HistoryOutputLimit: *args.HistoryOutputLimit,
+	}
+
+	store, err := session.Open(*args.SessionStore, *args.AppDir)
+	log.FatalfIf(err != nil, "unable to open session store. %v", err)
+
+	defer store.Close()
+
+	command, commandArgs := args.Command()
+
+	var deleteFiles session.DeleteFilesFunc
+
+	if *args.DeleteFiles {
+		deleteFiles = func(uris []string) error { return gemini.DeleteFiles(context.Background(), cfg, uris) }
+	}
+
 	{ // non-prompt commands
 		switch {
+		case command == "config":
+			log.FatalfIf(len(commandArgs) != 1 || commandArgs[0] != "show", "invalid config command. the supported form is '%v config show'", app)
+			cli.ShowConfig(args)
+			os.Exit(0)
+		case command == "files":
+			log.FatalfIf(len(commandArgs) != 1 || (commandArgs[0] != "list" && commandArgs[0] != "prune"), "invalid files command. the supported forms are '%v files list' and '%v files prune'", app, app)
+			err := cli.Files(context.Background(), cfg, args, store, commandArgs[0])
+			log.FatalfIf(err != nil, "%v", err)
+			os.Exit(0)
+		case command == "search":
+			log.FatalfIf(len(commandArgs) != 1, "invalid search command. the supported form is '%v search {text}'", app)
+			records, err := store.Search(commandArgs[0])
+			log.FatalfIf(err != nil, "unable to search sessions. %v", err)
+			cli.ListSessions(records)
+			os.Exit(0)
+		case command == "export":
+			ref := ""
+
+			if len(commandArgs) > 0 && !strings.HasPrefix(commandArgs[0], "-") {
+				ref, commandArgs = commandArgs[0], commandArgs[1:]
+			}
+
+			err := flag.CommandLine.Parse(commandArgs) // flags may follow the session, as in 'export {session} --format html'
+			log.FatalfIf(err != nil || flag.NArg() > 0, "invalid export command. the supported form is '%v export [session] [--format %v]'", app, strings.Join(cli.ExportFormats, "|"))
+			err = cli.Export(store, ref, *args.ExportFormat)
+			log.FatalfIf(err != nil, "unable to export session. %v", err)
+			os.Exit(0)
+		case command == "fork":
+			ref := ""
+
+			if len(commandArgs) > 0 && !strings.HasPrefix(commandArgs[0], "-") {
+				ref, commandArgs = commandArgs[0], commandArgs[1:]
+			}
+
+			err := flag.CommandLine.Parse(commandArgs) // flags may follow the session, as in 'fork {session} --at 2'
+			log.FatalfIf(err != nil || flag.NArg() > 0 || *args.ForkAt < 0, "invalid fork command. the supported form is '%v fork [session] [--at {turn}]'", app)
+			err = store.Fork(ref, *args.ForkAt)
+			log.FatalfIf(err != nil, "unable to fork session. %v", err)
+			os.Exit(0)
+		case command == "import":
+			log.FatalfIf(len(commandArgs) == 0, "invalid import command. the supported form is '%v import {file} [--name {name}]'", app)
+			err := flag.CommandLine.Parse(commandArgs[1:]) // flags may follow the file, as in 'import {file} --name {name}'
+			log.FatalfIf(err != nil || flag.NArg() > 0, "invalid import command. the supported form is '%v import {file} [--name {name}]'", app)
+			err = cli.Import(store, commandArgs[0], *args.SessionName)
+			log.FatalfIf(err != nil, "unable to import session. %v", err)
+			os.Exit(0)
+		case command == "undo":
+			log.FatalfIf(len(commandArgs) != 0, "invalid undo command. the supported form is '%v undo'", app)
+			removed, err := store.Undo(*args.Session)
+			log.FatalfIf(err != nil, "unable to undo last turn. %v", err)
+			cli.WriteInfo("removed the last turn (%v transaction(s)) from the session", len(removed))
+			os.Exit(0)
 		case *args.Version:
 			cli.Write("%v %v %v (pro-model: %v, flash-model: %v)\n", app, tag, commit, gemini.Models.Pro, gemini.Models.Flash)
 			os.Exit(0)
-		case args.RestoreSession() > 0:
-			err := session.Restore(*args.AppDir, args.RestoreSession())
+		case args.RestoreSession() != "":
+			err := store.Restore(args.RestoreSession())
 			log.FatalfIf(err != nil, "unable to restore session. %v", err)
 			os.Exit(0)
-		case args.DeleteSession() > 0:
-			err := session.Delete(*args.AppDir, args.DeleteSession())
+		case args.DeleteSession() != "":
+			err := store.Delete(args.DeleteSession(), deleteFiles)
 			log.FatalfIf(err != nil, "unable to delete session. %v", err)
 			os.Exit(0)
 		case *args.DeleteAllSessions:
-			err := session.DeleteAll(*args.AppDir)
+			err := store.DeleteAll(deleteFiles)
 			log.FatalfIf(err != nil, "unable to delete sessions. %v", err)
 			os.Exit(0)
 		case args.ListSessions():
-			records, err := session.List(*args.AppDir)
+			records, err := store.List()
 			log.FatalfIf(err != nil, "unable to list history. %v", err)
 			cli.ListSessions(records)
 			os.Exit(0)
 		}
 	}
 
-	if !args.ContinueSession() {
-		session.Stash(*args.AppDir)
+	if *args.Session != "" { // resolve the session to its id, so it remains identified should it be renamed
+		*args.Session, err = cli.ResolveSession(store, *args.Session)
+		log.FatalfIf(err != nil, "invalid session. %v", err)
 	}
 
-	log.FatalfIf(len(flag.Args()) != 1, "a single prompt is required")
+	if *args.SessionName != "" {
+		if len(flag.Args()) == 0 && !args.Interactive() { // no prompt, so only name the session
+			err := store.Rename(*args.Session, *args.SessionName)
+			log.FatalfIf(err != nil, "unable to name session. %v", err)
+			os.Exit(0)
+		}
 
-	promptText := flag.Arg(0)
+		err := cli.CheckSessionName(store, *args.Session, *args.SessionName, args.ContinueSession())
+		log.FatalfIf(err != nil, "invalid session name. %v", err)
+	}
 
-	model := gemini.Models.Flash
-	switch {
-	case *args.CustomModel != "":
-		model = *args.CustomModel
-	case *args.ProModel:
-		model = gemini.Models.Pro
+	replace := command == "retry" || command == "edit-last" // the prompt replaces the last turn of the session
+
+	if !args.ContinueSession() && *args.Session == "" && !replace { // prompts for a specified session do not change the active session
+		store.Stash()
+	}
+
+	promptText, attachments := flag.Arg(0), []gemini.Attachment{}
+
+	switch command {
+	case "retry":
+		log.FatalfIf(len(commandArgs) != 0 || args.Interactive(), "invalid retry command. the supported form is '%v [flags] retry'", app)
+		promptText = ""
+	case "edit-last":
+		log.FatalfIf(len(commandArgs) != 1 || args.Interactive(), "invalid edit-last command. the supported form is '%v [flags] edit-last {prompt}'", app)
+		promptText = commandArgs[0]
+	default:
+		log.FatalfIf(len(flag.Args()) != 1 && !(args.Interactive() && len(flag.Args()) == 0), "a single prompt is required")
+	}
+
+	if !args.Interactive() && command != "retry" { // data piped to stdin is included with the prompt
+		requested := promptText == "-" || *args.Stdin || *args.StdinAttach
+
+		if args.ExecutionApproval() { // approvals are read from stdin, so it cannot also be read for the prompt
+			log.FatalfIf(requested, "stdin cannot be read when command approval is enabled, as approval is read from stdin")
+
+			piped, err := cli.StdinPiped()
+			log.FatalfIf(err != nil, "%v", err)
+
+			if piped {
+				log.DebugPrintf("piped stdin ignored due to command approval", "type", "stdin_ignored")
+				cli.WriteInfo("the data piped to stdin is ignored, as command approvals are read from stdin")
+			}
+		} else {
+			stdin, piped, err := cli.ReadStdin()
+			log.FatalfIf(err != nil, "%v", err)
+			log.FatalfIf(requested && !piped, "reading the prompt or its data from stdin requires it to be piped to stdin")
+
+			switch {
+			case promptText == "-":
+				promptText = strings.TrimSpace(string(stdin))
+			case len(stdin) > 0 && *args.StdinAttach:
+				attachments = append(attachments, gemini.Attachment{Label: "stdin", MIMEType: *args.StdinMIMEType, Reader: bytes.NewReader(stdin)})
+			case len(stdin) > 0:
+				promptText += "\n\n<stdin>\n" + strings.TrimRight(string(stdin), "\n") + "\n</stdin>"
+			}
+		}
 	}
 
 	schema, err := schema.Build(args.SchemaDefinition())
@@ -93,20 +268,20 @@ func main() {
 		}
 	}
 
-	cli.Generate(gemini.Config{
-		GeminiURL:         *args.CustomURL,
-		Credential:        apiCredential,
-		GCPProject:        args.GCPProject(),
-		GCSBucket:         args.GCSBucket(),
-		Model:             model,
-		FileStorageURL:    *args.CustomUploadURL,
-		SystemPrompt:      *args.SystemPrompt,
-		MaxTokens:         *args.MaxTokens,
-		Temperature:       *args.Temperature,
-		TopP:              *args.TopP,
-		Grounding:         !*args.DisableGrounding,
-		UseCase:           *args.UseCase,
-		ExecutionEnabled:  args.ExecutionEnabled(),
-		ExecutionApproval: args.ExecutionApproval(),
-	}, args, args.Quiet(), promptText, schema, filePaths)
+	if args.Interactive() {
+		cli.Interactive(context.Background(), cfg, args, store, promptText, schema, filePaths)
+		os.Exit(0)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	context.AfterFunc(ctx, stop) // once cancelled, restore default handling so a further interrupt terminates the process immediately
+
+	if replace {
+		cli.Retry(ctx, cfg, args, store, args.Quiet(), promptText, schema, filePaths, attachments)
+		return
+	}
+
+	cli.Generate(ctx, cfg, args, store, args.Quiet(), promptText, schema, filePaths, attachments)
 }
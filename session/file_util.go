@@ -1,6 +1,8 @@
 package session
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"math/rand/v2"
 	"os"
@@ -51,29 +53,119 @@ func activeSessionFilePath(appDir string) (string, bool, error) {
 	return "", false, nil
 }
 
-func openActiveSessionFile(appDir string, flag int) (*os.File, error) {
+// sessionFilePath returns the path of the file of the session identified by the reference or, where the reference is empty, of the active
+// session, where one exists
+func sessionFilePath(appDir, ref string) (string, bool, error) {
+	if ref == "" {
+		return activeSessionFilePath(appDir)
+	}
+
+	record, err := find(appDir, ref)
+
+	if err != nil {
+		return "", false, err
+	}
+
 	sessionDir, err := sessionDir(appDir)
 	if err != nil {
-		return nil, err
+		return "", false, err
 	}
 
-	sessionFilePath, exists, err := activeSessionFilePath(appDir)
+	return path.Join(sessionDir, record.key), true, nil
+}
+
+// find returns the record of the session identified by the reference
+func find(appDir, ref string) (Record, error) {
+	records, err := List(appDir)
+
 	if err != nil {
-		return nil, err
+		return Record{}, err
 	}
 
-	if exists {
-		sessionFile, err := os.OpenFile(sessionFilePath, flag, 0600)
-		if err != nil {
-			return nil, fmt.Errorf("unable to open session file. %w", err)
+	return findRecord(records, ref)
+}
+
+// findRecord returns the record of the session identified by the reference or, where the reference is empty, of the active session
+func findRecord(records []Record, ref string) (Record, error) {
+	if ref != "" {
+		return Find(records, ref)
+	}
+
+	for _, r := range records {
+		if r.Active {
+			return r, nil
 		}
-		return sessionFile, nil
 	}
 
-	sessionFile, err := os.OpenFile(path.Join(sessionDir, strconv.FormatInt(time.Now().UnixNano(), 10)+"_"+strconv.Itoa(rand.Int())+ActiveSessionFileSuffix), flag|os.O_CREATE, 0600)
+	return Record{}, fmt.Errorf("no session is active")
+}
+
+// parseSessionFileName returns the id, parent id and name of the session stored in the named file. session files are named in the form
+// '{unixnano}_{random}[+{parent-id}][~{name}][.active]'. the id is derived from the part of the name fixed when the session is created, so is stable
+func parseSessionFileName(fileName string) (string, string, string) {
+	base, name, _ := strings.Cut(strings.TrimSuffix(fileName, ActiveSessionFileSuffix), "~")
+	base, parent, _ := strings.Cut(base, "+")
+	hash := sha256.Sum256([]byte(base))
+
+	return hex.EncodeToString(hash[:4]), parent, name
+}
+
+// sessionFileName returns the name of the session file with the session name replaced by the specified name
+func sessionFileName(fileName, name string) string {
+	suffix := ""
+
+	if strings.HasSuffix(fileName, ActiveSessionFileSuffix) {
+		suffix = ActiveSessionFileSuffix
+	}
+
+	base, _, _ := strings.Cut(strings.TrimSuffix(fileName, suffix), "~")
+
+	return base + "~" + name + suffix
+}
+
+// newActiveSessionFilePath returns the path of a new active session file, recording the id of the parent session where one is specified.
+// the name is based on the current unixnano time, so session files sort in the order they were created
+func newActiveSessionFilePath(sessionDir, parent string) string {
+	if parent != "" {
+		parent = "+" + parent
+	}
+
+	return path.Join(sessionDir, strconv.FormatInt(time.Now().UnixNano(), 10)+"_"+strconv.Itoa(rand.Int())+parent+ActiveSessionFileSuffix)
+}
+
+// writeFileAtomic writes the data to a temporary file in the app directory, which is then renamed over the specified file. the file is
+// therefore either replaced in full or left unchanged, even where the process is terminated part way through writing it
+func writeFileAtomic(appDir, file string, data []byte) error {
+	tmp, err := os.CreateTemp(appDir, "session-*.tmp")
+
 	if err != nil {
-		return nil, fmt.Errorf("unable to open session file. %w", err)
+		return fmt.Errorf("unable to create temporary session file. %w", err)
+	}
+
+	defer os.Remove(tmp.Name()) // no-op once the file is renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write temporary session file. %w", err)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to sync temporary session file. %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to close temporary session file. %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return fmt.Errorf("unable to replace session file. %w", err)
+	}
+
+	if dir, err := os.Open(path.Dir(file)); err == nil { // persist the rename. not all platforms support syncing directories, so errors are ignored
+		_ = dir.Sync()
+		dir.Close()
 	}
 
-	return sessionFile, nil
+	return nil
 }
@@ -0,0 +1,181 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/comradequinn/gen/gemini"
+)
+
+// sessions are stored as json lines, with one transaction encoded on each line, so a turn can be recorded by appending to the file.
+// sessions written by earlier versions are stored as a single json array of transactions. both formats are read, with active sessions
+// in the array format migrated to json lines when they are next written
+
+// readTransactions returns the transactions encoded in either session format. a final line that is incomplete, such as where the process
+// was terminated while appending it, is ignored
+func readTransactions(r io.Reader) ([]gemini.Transaction, error) {
+	decoder, array, err := newDecoder(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	transactions := []gemini.Transaction{}
+
+	if array {
+		if err := decoder.Decode(&transactions); err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		return transactions, nil
+	}
+
+	for {
+		transaction := gemini.Transaction{}
+
+		switch err := decoder.Decode(&transaction); {
+		case err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF):
+			return transactions, nil
+		case err != nil:
+			return nil, err
+		}
+
+		transactions = append(transactions, transaction)
+	}
+}
+
+// readFirstTransaction returns the first transaction encoded in either session format, without reading those that follow it
+func readFirstTransaction(r io.Reader) (gemini.Transaction, bool, error) {
+	decoder, array, err := newDecoder(r)
+
+	if err != nil {
+		return gemini.Transaction{}, false, err
+	}
+
+	if array {
+		if _, err := decoder.Token(); err != nil { // consume the opening bracket of the array
+			return gemini.Transaction{}, false, ignoreEOF(err)
+		}
+
+		if !decoder.More() {
+			return gemini.Transaction{}, false, nil
+		}
+	}
+
+	transaction := gemini.Transaction{}
+
+	if err := decoder.Decode(&transaction); err != nil {
+		return gemini.Transaction{}, false, ignoreEOF(err)
+	}
+
+	return transaction, true, nil
+}
+
+// newDecoder returns a decoder of the session data, indicating whether it is encoded in the array format
+func newDecoder(r io.Reader) (*json.Decoder, bool, error) {
+	br := bufio.NewReader(r)
+
+	for {
+		b, err := br.Peek(1)
+
+		if err == io.EOF {
+			return json.NewDecoder(br), false, nil
+		}
+
+		if err != nil {
+			return nil, false, fmt.Errorf("unable to read session data. %w", err)
+		}
+
+		if !bytes.ContainsAny(b, " \t\r\n") {
+			return json.NewDecoder(br), b[0] == '[', nil
+		}
+
+		_, _ = br.Discard(1)
+	}
+}
+
+// normaliseSessionFile rewrites the session file as json lines where it is in the array format or ends with an incomplete line, so
+// further transactions can be appended to it. only the leading and final bytes are read unless the file needs rewriting
+func normaliseSessionFile(appDir, file string) error {
+	f, err := os.Open(file)
+
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return fmt.Errorf("unable to open session file. %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+
+	if err != nil {
+		return fmt.Errorf("unable to stat session file. %w", err)
+	}
+
+	if info.Size() == 0 {
+		return nil
+	}
+
+	last := make([]byte, 1)
+
+	if _, err := f.ReadAt(last, info.Size()-1); err != nil {
+		return fmt.Errorf("unable to read session file. %w", err)
+	}
+
+	_, isArray, err := newDecoder(f)
+
+	if err != nil {
+		return err
+	}
+
+	if !isArray && last[0] == '\n' {
+		return nil
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("unable to read session file. %w", err)
+	}
+
+	transactions, err := readTransactions(f)
+
+	if err != nil {
+		return fmt.Errorf("unable to decode session file. %w", err)
+	}
+
+	encoded, err := encodeTransactions(transactions)
+
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(appDir, file, encoded)
+}
+
+// encodeTransactions returns the transactions encoded as json lines
+func encodeTransactions(transactions []gemini.Transaction) ([]byte, error) {
+	buf := bytes.Buffer{}
+	encoder := json.NewEncoder(&buf) // the encoder terminates each value with a newline
+
+	for _, t := range transactions {
+		if err := encoder.Encode(t); err != nil {
+			return nil, fmt.Errorf("unable to encode session transaction. %w", err)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+func ignoreEOF(err error) error {
+	if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package session
+
+// lock is a no-op on platforms without advisory file locking. session files are still replaced atomically, but concurrent
+// invocations may lose each other's writes
+func lock(appDir string) (func(), error) {
+	if _, err := sessionDir(appDir); err != nil {
+		return nil, err
+	}
+
+	return func() {}, nil
+}
@@ -0,0 +1,53 @@
+//go:build unix
+
+package session
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"syscall"
+	"time"
+)
+
+// lock acquires an exclusive advisory lock on the sessions in the app directory, waiting up to lockTimeout for another process that
+// holds it to release it. the returned func releases the lock. locks are released by the os if the process exits, so are never stale
+func lock(appDir string) (func(), error) {
+	if _, err := sessionDir(appDir); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path.Join(appDir, lockFileName), os.O_CREATE|os.O_RDWR, 0600)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to open session lock file. %w", err)
+	}
+
+	deadline := time.Now().Add(lockTimeout)
+
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+
+		if err == nil {
+			break
+		}
+
+		if !errors.Is(err, syscall.EWOULDBLOCK) && !errors.Is(err, syscall.EINTR) {
+			f.Close()
+			return nil, fmt.Errorf("unable to lock session. %w", err)
+		}
+
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("unable to lock session. it has been in use by another process for more than %v. retry once that process has completed", lockTimeout)
+		}
+
+		time.Sleep(lockRetryInterval)
+	}
+
+	return func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
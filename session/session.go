@@ -1,12 +1,14 @@
 package session
 
 import (
-	"encoding/json"
+	"bytes"
 	"fmt"
-	"io"
 	"os"
 	"path"
+	"regexp"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,59 +21,115 @@ type (
 		Response gemini.Output
 	}
 	Record struct {
-		ID        int
-		Name      string
+		ID        string // a stable identifier of the session, which does not change as other sessions are created or deleted
+		Index     int    // the 1-based position of the session when all sessions are listed in the order they were last updated
+		Name      string // optional. a name given to the session to identify it
+		Parent    string // optional. the id of the session this session was forked from
 		Summary   string
 		TimeStamp time.Time
 		Active    bool
+		key       string // identifies the session within its store, such as the name of its file
 	}
+	// DeleteFilesFunc deletes the uploaded files with the specified uris from file storage
+	DeleteFilesFunc func(uris []string) error
 )
 
 const ActiveSessionFileSuffix = ".active"
 
-// Write adds the specified entry to the active session
-func Write(appDir string, transaction gemini.Transaction) error {
-	transactions, err := Read(appDir)
+var validName = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]*$`)
+
+const (
+	lockFileName      = "session.lock"
+	lockTimeout       = 30 * time.Second
+	lockRetryInterval = 50 * time.Millisecond
+)
+
+// Write appends the specified entry to the session identified by the reference or, where the reference is empty, to the active session,
+// starting a new session where none is active. the session is locked while it is updated, so concurrent writes from other processes are
+// not lost. a session stored in the format of earlier versions is migrated before the entry is appended
+func Write(appDir, ref string, transaction gemini.Transaction) error {
+	unlock, err := lock(appDir)
 
 	if err != nil {
 		return err
 	}
 
-	f, err := openActiveSessionFile(appDir, os.O_WRONLY|os.O_TRUNC)
+	defer unlock()
+
+	sessionFile, exists, err := sessionFilePath(appDir, ref)
 
 	if err != nil {
 		return err
 	}
 
+	if !exists {
+		sessionDir, err := sessionDir(appDir)
+
+		if err != nil {
+			return err
+		}
+
+		sessionFile = newActiveSessionFilePath(sessionDir, "")
+	}
+
+	if err := normaliseSessionFile(appDir, sessionFile); err != nil {
+		return err
+	}
+
+	data, err := encodeTransactions([]gemini.Transaction{transaction})
+
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(sessionFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+
+	if err != nil {
+		return fmt.Errorf("unable to open session file. %w", err)
+	}
+
 	defer f.Close()
 
-	jsonEncoder := json.NewEncoder(f)
-	jsonEncoder.SetIndent("", "  ")
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("unable to write session file. %w", err)
+	}
 
-	if err := jsonEncoder.Encode(append(transactions, transaction)); err != nil {
-		return fmt.Errorf("unable to encode session file. %w", err)
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("unable to sync session file. %w", err)
 	}
 
 	return nil
 }
 
-// Read returns all messages in the active session
-func Read(appDir string) ([]gemini.Transaction, error) {
-	f, err := openActiveSessionFile(appDir, os.O_RDONLY)
+// Read returns all messages in the session identified by the reference or, where the reference is empty, in the active session. as
+// session files are only ever appended to or replaced atomically, reading does not require the session to be locked
+func Read(appDir, ref string) ([]gemini.Transaction, error) {
+	sessionFile, exists, err := sessionFilePath(appDir, ref)
 
 	if err != nil {
 		return nil, err
 	}
 
-	defer f.Close()
+	if !exists {
+		return []gemini.Transaction{}, nil
+	}
 
-	transactions := []gemini.Transaction{}
+	return readSessionFile(sessionFile)
+}
 
-	if err := json.NewDecoder(f).Decode(&transactions); err != nil {
-		if err == io.EOF {
-			return []gemini.Transaction{}, nil
-		}
+// readSessionFile returns all transactions in the session file
+func readSessionFile(sessionFile string) ([]gemini.Transaction, error) {
+	f, err := os.Open(sessionFile)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to open session file. %w", err)
+	}
+
+	defer f.Close()
 
+	transactions, err := readTransactions(f)
+
+	if err != nil {
 		return nil, fmt.Errorf("unable to decode session file. %w", err)
 	}
 
@@ -101,28 +159,22 @@ func List(appDir string) ([]Record, error) {
 
 		defer sessionFile.Close()
 
-		transactions := []gemini.Transaction{}
+		transaction, ok, err := readFirstTransaction(sessionFile)
 
-		if err := json.NewDecoder(sessionFile).Decode(&transactions); err != nil && err != io.EOF {
+		if err != nil {
 			return "", fmt.Errorf("unable to decode session file. %v %w", sessionFile, err)
 		}
 
-		if len(transactions) == 0 {
-			return "[ no content ]", nil
-		}
-
-		const limit = 50
-
-		if len(transactions[0].Input.Text) < limit {
-			return transactions[0].Input.Text, nil
+		if !ok {
+			return summary(""), nil
 		}
 
-		return transactions[0].Input.Text[:limit] + "...", nil
+		return summary(transaction.Input.Text), nil
 	}
 
 	records := make([]Record, 0, len(files))
 
-	for i, f := range files { // files are sorted by file name which is based on the unixnano time at the point of writing; which is the sort order required
+	for _, f := range files {
 		if !f.Type().IsRegular() {
 			continue
 		}
@@ -139,12 +191,16 @@ func List(appDir string) ([]Record, error) {
 			return nil, fmt.Errorf("unable to get timestamp for session file %v. %w", f.Name(), err)
 		}
 
+		id, parent, name := parseSessionFileName(f.Name())
+
 		records = append(records, Record{
-			ID:        i + 1,
-			Name:      f.Name(),
+			ID:        id,
+			Parent:    parent,
+			Name:      name,
 			Summary:   summary,
 			TimeStamp: info.ModTime(),
 			Active:    strings.HasSuffix(f.Name(), ActiveSessionFileSuffix),
+			key:       f.Name(),
 		})
 	}
 
@@ -152,11 +208,87 @@ func List(appDir string) ([]Record, error) {
 		return records[i].TimeStamp.Before(records[j].TimeStamp)
 	})
 
+	for i := range records {
+		records[i].Index = i + 1
+	}
+
 	return records, nil
 }
 
+// Find returns the record of the session identified by the reference, being its id, its name or its index, in that order of precedence
+func Find(records []Record, ref string) (Record, error) {
+	for _, r := range records {
+		if r.ID == ref {
+			return r, nil
+		}
+	}
+
+	for _, r := range records {
+		if r.Name != "" && r.Name == ref {
+			return r, nil
+		}
+	}
+
+	if i, err := strconv.Atoi(ref); err == nil && i >= 1 && i <= len(records) {
+		return records[i-1], nil
+	}
+
+	return Record{}, fmt.Errorf("session '%v' not found", ref)
+}
+
+// ValidateName returns an error where the name cannot be given to a session. names must start with a letter, so they are never mistaken
+// for an index, and contain only letters, digits, underscores and hyphens
+func ValidateName(name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid session name '%v'. names must start with a letter and contain only letters, digits, underscores and hyphens", name)
+	}
+
+	return nil
+}
+
+// checkName returns an error where the name is invalid or is already given to a session other than the one specified
+func checkName(records []Record, record Record, name string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+
+	for _, r := range records {
+		if r.key != record.key && (r.Name == name || r.ID == name) {
+			return fmt.Errorf("session name '%v' is already in use by session %v", name, r.ID)
+		}
+	}
+
+	return nil
+}
+
+// summary returns the opening text of a session's first prompt, for display when listing sessions
+func summary(prompt string) string {
+	const limit = 50
+
+	switch {
+	case prompt == "":
+		return "[ no content ]"
+	case len(prompt) < limit:
+		return prompt
+	default:
+		return prompt[:limit] + "..."
+	}
+}
+
 // Stash saves the current session and starts a new one
 func Stash(appDir string) error {
+	unlock, err := lock(appDir)
+
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	return stash(appDir)
+}
+
+func stash(appDir string) error {
 	sessionFile, exists, err := activeSessionFilePath(appDir)
 
 	if !exists || err != nil {
@@ -170,19 +302,21 @@ func Stash(appDir string) error {
 	return nil
 }
 
-// Restore sets the specified stashed session as the active session
-func Restore(appDir string, recordID int) error {
-	records, err := List(appDir)
+// Restore sets the session identified by the reference as the active session
+func Restore(appDir, ref string) error {
+	unlock, err := lock(appDir)
 
 	if err != nil {
 		return err
 	}
 
-	if recordID > len(records) {
-		return fmt.Errorf("invalid record id %v", recordID)
-	}
+	defer unlock()
+
+	record, err := find(appDir, ref)
 
-	record := records[recordID-1]
+	if err != nil {
+		return err
+	}
 
 	if record.Active {
 		return nil
@@ -193,54 +327,445 @@ func Restore(appDir string, recordID int) error {
 		return err
 	}
 
-	if err := Stash(appDir); err != nil {
+	if err := stash(appDir); err != nil {
 		return err
 	}
 
-	if err := os.Rename(path.Join(sessionDir, record.Name), path.Join(sessionDir, record.Name+ActiveSessionFileSuffix)); err != nil {
+	if err := os.Rename(path.Join(sessionDir, record.key), path.Join(sessionDir, record.key+ActiveSessionFileSuffix)); err != nil {
 		return fmt.Errorf("unable to restore session file. %w", err)
 	}
 
 	return nil
 }
 
-// Delete removes the specified session
-func Delete(appDir string, recordID int) error {
+// Rename gives the specified name to the session identified by the reference or, where the reference is empty, to the active session
+func Rename(appDir, ref, name string) error {
+	unlock, err := lock(appDir)
+
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	records, err := List(appDir)
+
+	if err != nil {
+		return err
+	}
+
+	record, err := findRecord(records, ref)
+
+	if err != nil {
+		return err
+	}
+
+	if err := checkName(records, record, name); err != nil {
+		return err
+	}
+
+	sessionDir, err := sessionDir(appDir)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(path.Join(sessionDir, record.key), path.Join(sessionDir, sessionFileName(record.key, name))); err != nil {
+		return fmt.Errorf("unable to rename session file. %w", err)
+	}
+
+	return nil
+}
+
+// Fork copies the session identified by the reference or, where the reference is empty, the active session into a new active session
+// whose parent is the copied session. where turns is greater than zero, only that number of turns are copied from the start of the session
+func Fork(appDir, ref string, turns int) error {
+	unlock, err := lock(appDir)
+
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
 	records, err := List(appDir)
 
 	if err != nil {
 		return err
 	}
 
-	if recordID > len(records) {
-		return fmt.Errorf("invalid record id %v", recordID)
+	record, err := findRecord(records, ref)
+
+	if err != nil {
+		return err
+	}
+
+	transactions, err := Read(appDir, record.ID)
+
+	if err != nil {
+		return err
+	}
+
+	if transactions, err = truncateTurns(transactions, turns); err != nil {
+		return err
+	}
+
+	data, err := encodeTransactions(transactions)
+
+	if err != nil {
+		return err
+	}
+
+	sessionDir, err := sessionDir(appDir)
+	if err != nil {
+		return err
+	}
+
+	if err := stash(appDir); err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(appDir, newActiveSessionFilePath(sessionDir, record.ID), data); err != nil {
+		return fmt.Errorf("unable to write forked session file. %w", err)
+	}
+
+	return nil
+}
+
+// Create writes the transactions to a new session, given the name where one is specified, and sets it as the active session. the session
+// is written in full before the active session is stashed, so a failure leaves the active session unchanged
+func Create(appDir string, transactions []gemini.Transaction, name string) error {
+	unlock, err := lock(appDir)
+
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	if name != "" {
+		records, err := List(appDir)
+
+		if err != nil {
+			return err
+		}
+
+		if err := checkName(records, Record{}, name); err != nil {
+			return err
+		}
+	}
+
+	data, err := encodeTransactions(transactions)
+
+	if err != nil {
+		return err
+	}
+
+	sessionDir, err := sessionDir(appDir)
+	if err != nil {
+		return err
+	}
+
+	sessionFile := strings.TrimSuffix(newActiveSessionFilePath(sessionDir, ""), ActiveSessionFileSuffix) // written inactive, then activated once the active session is stashed
+
+	if name != "" {
+		sessionFile = path.Join(sessionDir, sessionFileName(path.Base(sessionFile), name))
+	}
+
+	if err := writeFileAtomic(appDir, sessionFile, data); err != nil {
+		return fmt.Errorf("unable to write session file. %w", err)
+	}
+
+	if err := stash(appDir); err != nil {
+		return err
+	}
+
+	if err := os.Rename(sessionFile, sessionFile+ActiveSessionFileSuffix); err != nil {
+		return fmt.Errorf("unable to activate session file. %w", err)
+	}
+
+	return nil
+}
+
+// Undo removes the last turn from the session identified by the reference or, where the reference is empty, from the active session.
+// the removed transactions are returned, starting with that holding the prompt of the turn
+func Undo(appDir, ref string) ([]gemini.Transaction, error) {
+	return replaceLastTurn(appDir, ref, nil)
+}
+
+// Replace removes the last turn from the session identified by the reference or, where the reference is empty, from the active session
+// and appends the transaction in its place. the session file is replaced atomically, so the last turn is never removed without the
+// transaction being appended
+func Replace(appDir, ref string, transaction gemini.Transaction) error {
+	_, err := replaceLastTurn(appDir, ref, []gemini.Transaction{transaction})
+	return err
+}
+
+// replaceLastTurn replaces the last turn of the referenced session with the specified transactions, returning the transactions removed
+func replaceLastTurn(appDir, ref string, replacement []gemini.Transaction) ([]gemini.Transaction, error) {
+	unlock, err := lock(appDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer unlock()
+
+	sessionFile, exists, err := sessionFilePath(appDir, ref)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, fmt.Errorf("no session is active")
+	}
+
+	transactions, err := readSessionFile(sessionFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	last := LastTurn(transactions)
+
+	if last < 0 {
+		return nil, fmt.Errorf("the session has no turns to replace")
+	}
+
+	data, err := encodeTransactions(append(slices.Clone(transactions[:last]), replacement...))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeFileAtomic(appDir, sessionFile, data); err != nil {
+		return nil, err
+	}
+
+	return transactions[last:], nil
+}
+
+// LastTurn returns the index of the transaction holding the prompt of the last turn of a session. -1 is returned where the session has no turns
+func LastTurn(transactions []gemini.Transaction) int {
+	for i := len(transactions) - 1; i >= 0; i-- {
+		if transactions[i].Input.Type != gemini.InputTypeFunction && !transactions[i].Input.IsSummary() {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// truncateTurns returns the transactions of the first turns of a session. each turn starts with a user prompt and includes any function calls,
+// and summaries, that follow it. where turns is zero or less, all transactions are returned. an error is returned where the session has fewer turns
+func truncateTurns(transactions []gemini.Transaction, turns int) ([]gemini.Transaction, error) {
+	if turns <= 0 {
+		return transactions, nil
+	}
+
+	count := 0
+
+	for i, t := range transactions {
+		if t.Input.Type == gemini.InputTypeFunction || t.Input.IsSummary() {
+			continue
+		}
+
+		if count++; count > turns {
+			return transactions[:i], nil
+		}
+	}
+
+	if count < turns {
+		return nil, fmt.Errorf("unable to truncate session at turn %v. the session has %v turn(s)", turns, count)
+	}
+
+	return transactions, nil
+}
+
+// Delete removes the session identified by the reference. where deleteFiles is specified, it is passed the uris of the uploaded files
+// referenced by the session that are not also referenced by another session, so they can be deleted from file storage
+func Delete(appDir, ref string, deleteFiles DeleteFilesFunc) error {
+	unlock, err := lock(appDir)
+
+	if err != nil {
+		return err
 	}
 
-	record := records[recordID-1]
+	defer unlock()
+
+	record, err := find(appDir, ref)
+
+	if err != nil {
+		return err
+	}
 
 	sessionDir, err := sessionDir(appDir)
 	if err != nil {
 		return err
 	}
 
-	if err := os.Remove(path.Join(sessionDir, record.Name)); err != nil {
+	if deleteFiles != nil {
+		uris, err := fileURIs(sessionDir, func(name string) bool { return name == record.key })
+
+		if err != nil {
+			return err
+		}
+
+		retained, err := fileURIs(sessionDir, func(name string) bool { return name != record.key })
+
+		if err != nil {
+			return err
+		}
+
+		uris = slices.DeleteFunc(uris, func(uri string) bool { return slices.Contains(retained, uri) })
+
+		if err := deleteFiles(uris); err != nil {
+			return fmt.Errorf("unable to delete files referenced by session. %w", err)
+		}
+	}
+
+	if err := os.Remove(path.Join(sessionDir, record.key)); err != nil {
 		return fmt.Errorf("unable to delete session file. %w", err)
 	}
 
 	return nil
 }
 
-// DeleteAll removes all stashed sessions
-func DeleteAll(appDir string) error {
+// DeleteAll removes all stashed sessions. where deleteFiles is specified, it is passed the uris of all uploaded files referenced by the
+// sessions, so they can be deleted from file storage
+func DeleteAll(appDir string, deleteFiles DeleteFilesFunc) error {
+	unlock, err := lock(appDir)
+
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
 	sessionDir, err := sessionDir(appDir)
 
 	if err != nil {
 		return err
 	}
 
+	if deleteFiles != nil {
+		uris, err := fileURIs(sessionDir, func(string) bool { return true })
+
+		if err != nil {
+			return err
+		}
+
+		if err := deleteFiles(uris); err != nil {
+			return fmt.Errorf("unable to delete files referenced by sessions. %w", err)
+		}
+	}
+
 	if err := os.RemoveAll(sessionDir); err != nil {
 		return fmt.Errorf("unable to delete all session data. %w", err)
 	}
 
 	return nil
 }
+
+// Search returns the records of the sessions with a prompt or response that contains the query, ignoring case
+func Search(appDir, query string) ([]Record, error) {
+	records, err := List(appDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sessionDir, err := sessionDir(appDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []Record{}
+
+	for _, r := range records {
+		f, err := os.Open(path.Join(sessionDir, r.key))
+
+		if err != nil {
+			return nil, fmt.Errorf("unable to open session file %v. %w", r.key, err)
+		}
+
+		transactions, err := readTransactions(f)
+		f.Close()
+
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode session file %v. %w", r.key, err)
+		}
+
+		if slices.ContainsFunc(transactions, func(t gemini.Transaction) bool { return contains(t, query) }) {
+			matches = append(matches, r)
+		}
+	}
+
+	return matches, nil
+}
+
+// FileURIs returns the uris of the uploaded files referenced by all sessions
+func FileURIs(appDir string) ([]string, error) {
+	sessionDir, err := sessionDir(appDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return fileURIs(sessionDir, func(string) bool { return true })
+}
+
+// fileURIs returns the distinct uris of the uploaded files referenced by the session files that match the filter
+func fileURIs(sessionDir string, filter func(name string) bool) ([]string, error) {
+	files, err := os.ReadDir(sessionDir)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to read session directory. %w", err)
+	}
+
+	uris := []string{}
+
+	for _, f := range files {
+		if !f.Type().IsRegular() || !filter(f.Name()) {
+			continue
+		}
+
+		data, err := os.ReadFile(path.Join(sessionDir, f.Name()))
+
+		if err != nil {
+			return nil, fmt.Errorf("unable to read session file %v. %w", f.Name(), err)
+		}
+
+		transactions, err := readTransactions(bytes.NewReader(data))
+
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode session file %v. %w", f.Name(), err)
+		}
+
+		uris = appendFileURIs(uris, transactions)
+	}
+
+	return uris, nil
+}
+
+// contains reports whether the prompt or response of the transaction contains the query, ignoring case
+func contains(t gemini.Transaction, query string) bool {
+	query = strings.ToLower(query)
+
+	return strings.Contains(strings.ToLower(t.Input.Text), query) || strings.Contains(strings.ToLower(t.Output.Text), query)
+}
+
+// appendFileURIs appends the uris of the uploaded files referenced by the transactions that are not already present. files included
+// inline have no uri so are omitted
+func appendFileURIs(uris []string, transactions []gemini.Transaction) []string {
+	for _, t := range transactions {
+		for _, ref := range t.Input.FileReferences {
+			if ref.URI != "" && !slices.Contains(uris, ref.URI) {
+				uris = append(uris, ref.URI)
+			}
+		}
+	}
+
+	return uris
+}
@@ -1,7 +1,12 @@
 package session_test
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/comradequinn/gen/gemini"
@@ -15,7 +20,7 @@ func TestSession(t *testing.T) {
 	defer os.RemoveAll(testDir)
 
 	writeSession := func(prompt, response string) {
-		if err := session.Write(testDir,
+		if err := session.Write(testDir, "",
 			gemini.Transaction{
 				Input:  gemini.Input{Text: prompt},
 				Output: gemini.Output{Text: response},
@@ -28,7 +33,7 @@ func TestSession(t *testing.T) {
 	writeSession("test-prompt-2", "test-response-2")
 	writeSession("test-prompt-3", "test-response-3")
 
-	actualsession, err := session.Read(testDir)
+	actualsession, err := session.Read(testDir, "")
 
 	if err != nil {
 		t.Fatalf("expected no error reading session. got %v", err)
@@ -59,7 +64,7 @@ func TestSession(t *testing.T) {
 		t.Fatalf("expected no error stashing session. got %v", err)
 	}
 
-	if actualsession, err = session.Read(testDir); err != nil {
+	if actualsession, err = session.Read(testDir, ""); err != nil {
 		t.Fatalf("expected no error reading session. got %v", err)
 	}
 
@@ -79,7 +84,7 @@ func TestSession(t *testing.T) {
 		t.Fatalf("expected latest session to be active. got %+v", records)
 	}
 
-	if err := session.Restore(testDir, 1); err != nil {
+	if err := session.Restore(testDir, "1"); err != nil {
 		t.Fatalf("expected no error restoring session. got %v", err)
 	}
 
@@ -93,7 +98,7 @@ func TestSession(t *testing.T) {
 		t.Fatalf("expected restored session to be active. got %+v", records)
 	}
 
-	if err := session.Delete(testDir, 2); err != nil {
+	if err := session.Delete(testDir, "2", nil); err != nil {
 		t.Fatalf("expected no error deleting session. got %v", err)
 	}
 
@@ -105,7 +110,7 @@ func TestSession(t *testing.T) {
 
 	assertInt(len(records), 1, "record count")
 
-	if err := session.DeleteAll(testDir); err != nil {
+	if err := session.DeleteAll(testDir, nil); err != nil {
 		t.Fatalf("expected no error deleting all sessions. got %v", err)
 	}
 
@@ -117,3 +122,151 @@ func TestSession(t *testing.T) {
 
 	assertInt(len(records), 0, "record count")
 }
+
+func TestDeleteFiles(t *testing.T) {
+	testDir := t.TempDir()
+
+	writeSession := func(refs ...gemini.FileReference) {
+		if err := session.Write(testDir, "", gemini.Transaction{
+			Input:  gemini.Input{Text: "test-prompt", FileReferences: refs},
+			Output: gemini.Output{Text: "test-response"},
+		}); err != nil {
+			t.Fatalf("expected no error writing session. got %v", err)
+		}
+	}
+
+	writeSession(gemini.FileReference{URI: "test-uri-1"}, gemini.FileReference{URI: "test-uri-2"}, gemini.FileReference{Data: []byte("test-inline-data")})
+
+	if err := session.Stash(testDir); err != nil {
+		t.Fatalf("expected no error stashing session. got %v", err)
+	}
+
+	writeSession(gemini.FileReference{URI: "test-uri-2"})
+
+	deleted := []string{}
+	deleteFiles := func(uris []string) error {
+		deleted = append(deleted, uris...)
+		return nil
+	}
+
+	if err := session.Delete(testDir, "1", deleteFiles); err != nil {
+		t.Fatalf("expected no error deleting session. got %v", err)
+	}
+
+	if len(deleted) != 1 || deleted[0] != "test-uri-1" {
+		t.Fatalf("expected only the file not referenced by another session to be deleted. got %v", deleted)
+	}
+
+	deleted = nil
+
+	if err := session.DeleteAll(testDir, deleteFiles); err != nil {
+		t.Fatalf("expected no error deleting all sessions. got %v", err)
+	}
+
+	if len(deleted) != 1 || deleted[0] != "test-uri-2" {
+		t.Fatalf("expected remaining referenced files to be deleted. got %v", deleted)
+	}
+}
+
+func TestConcurrentWrite(t *testing.T) {
+	testDir := t.TempDir()
+
+	const writers = 20
+
+	wg := sync.WaitGroup{}
+
+	for i := range writers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if err := session.Write(testDir, "", gemini.Transaction{
+				Input:  gemini.Input{Text: fmt.Sprintf("test-prompt-%v", i)},
+				Output: gemini.Output{Text: fmt.Sprintf("test-response-%v", i)},
+			}); err != nil {
+				t.Errorf("expected no error writing session. got %v", err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	transactions, err := session.Read(testDir, "")
+
+	if err != nil {
+		t.Fatalf("expected no error reading session. got %v", err)
+	}
+
+	if len(transactions) != writers {
+		t.Fatalf("expected all %v concurrent writes to be recorded. got %v", writers, len(transactions))
+	}
+
+	if tmp, _ := filepath.Glob(filepath.Join(testDir, "*.tmp")); len(tmp) > 0 {
+		t.Fatalf("expected no temporary session files to remain. got %v", tmp)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	testDir := t.TempDir()
+	sessionFile := filepath.Join(testDir, "session", "1000_1"+session.ActiveSessionFileSuffix)
+
+	legacy, _ := json.MarshalIndent([]gemini.Transaction{
+		{Input: gemini.Input{Text: "test-prompt-1"}, Output: gemini.Output{Text: "test-response-1"}},
+		{Input: gemini.Input{Text: "test-prompt-2"}, Output: gemini.Output{Text: "test-response-2"}},
+	}, "", "  ")
+
+	if err := os.MkdirAll(filepath.Dir(sessionFile), 0755); err != nil {
+		t.Fatalf("unable to create session directory. %v", err)
+	}
+
+	if err := os.WriteFile(sessionFile, legacy, 0600); err != nil {
+		t.Fatalf("unable to write legacy session file. %v", err)
+	}
+
+	records, err := session.List(testDir)
+
+	if err != nil || len(records) != 1 || records[0].Summary != "test-prompt-1" {
+		t.Fatalf("expected legacy session to be summarised by its first prompt. got %+v, %v", records, err)
+	}
+
+	if err := session.Write(testDir, "", gemini.Transaction{Input: gemini.Input{Text: "test-prompt-3"}, Output: gemini.Output{Text: "test-response-3"}}); err != nil {
+		t.Fatalf("expected no error writing session. got %v", err)
+	}
+
+	data, err := os.ReadFile(sessionFile)
+
+	if err != nil {
+		t.Fatalf("unable to read session file. %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+
+	if len(lines) != 3 {
+		t.Fatalf("expected legacy session to be migrated to one line per transaction. got %v", string(data))
+	}
+
+	if err := os.WriteFile(sessionFile, append(data, []byte(`{"Input":{"Text":"test-pro`)...), 0600); err != nil { // simulate an interrupted append
+		t.Fatalf("unable to write session file. %v", err)
+	}
+
+	transactions, err := session.Read(testDir, "")
+
+	if err != nil || len(transactions) != 3 {
+		t.Fatalf("expected incomplete final line to be ignored. got %v transactions, %v", len(transactions), err)
+	}
+
+	for i, transaction := range transactions {
+		if expected := fmt.Sprintf("test-prompt-%v", i+1); transaction.Input.Text != expected {
+			t.Fatalf("expected transaction %v to have prompt %v. got %v", i, expected, transaction.Input.Text)
+		}
+	}
+
+	if err := session.Write(testDir, "", gemini.Transaction{Input: gemini.Input{Text: "test-prompt-4"}}); err != nil {
+		t.Fatalf("expected no error writing session. got %v", err)
+	}
+
+	if transactions, err = session.Read(testDir, ""); err != nil || len(transactions) != 4 || transactions[3].Input.Text != "test-prompt-4" {
+		t.Fatalf("expected incomplete final line to be replaced by the next write. got %+v, %v", transactions, err)
+	}
+}
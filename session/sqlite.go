@@ -0,0 +1,549 @@
+package session
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/comradequinn/gen/gemini"
+	_ "modernc.org/sqlite"
+)
+
+type (
+	// sqliteStore stores sessions in a sqlite database, which may be shared with other tools that embed the session package
+	sqliteStore struct {
+		db *sql.DB
+	}
+	querier interface {
+		Query(query string, args ...any) (*sql.Rows, error)
+		QueryRow(query string, args ...any) *sql.Row
+	}
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS sessions (
+	id      INTEGER PRIMARY KEY AUTOINCREMENT,
+	uid     TEXT NOT NULL UNIQUE,
+	name    TEXT UNIQUE,
+	parent  TEXT,
+	created INTEGER NOT NULL,
+	updated INTEGER NOT NULL,
+	active  INTEGER NOT NULL DEFAULT 0
+);
+CREATE TABLE IF NOT EXISTS transactions (
+	session_id INTEGER NOT NULL REFERENCES sessions (id) ON DELETE CASCADE,
+	seq        INTEGER NOT NULL,
+	created    INTEGER NOT NULL,
+	prompt     TEXT NOT NULL,
+	response   TEXT NOT NULL,
+	data       TEXT NOT NULL,
+	PRIMARY KEY (session_id, seq)
+);`
+
+// NewSQLiteStore returns a store that holds sessions in the specified sqlite database file, creating it where it does not exist.
+// concurrent writers wait for each other, up to the lock timeout, rather than failing
+func NewSQLiteStore(file string) (Store, error) {
+	dsn := fmt.Sprintf("file:%v?_pragma=busy_timeout(%v)&_txlock=immediate&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)", file, lockTimeout.Milliseconds())
+
+	db, err := sql.Open("sqlite", dsn)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to open session database. %w", err)
+	}
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unable to create session database schema. %w", err)
+	}
+
+	return sqliteStore{db: db}, nil
+}
+
+func (s sqliteStore) Read(ref string) ([]gemini.Transaction, error) {
+	id, err := s.sessionID(s.db, ref)
+
+	switch {
+	case err == sql.ErrNoRows && ref == "":
+		return []gemini.Transaction{}, nil
+	case err != nil:
+		return nil, err
+	}
+
+	return queryTransactions(s.db, `SELECT data FROM transactions WHERE session_id = ? ORDER BY seq`, id)
+}
+
+func (s sqliteStore) Append(ref string, transaction gemini.Transaction) error {
+	data, err := json.Marshal(transaction)
+
+	if err != nil {
+		return fmt.Errorf("unable to encode session transaction. %w", err)
+	}
+
+	return s.update(func(tx *sql.Tx) error {
+		now := time.Now().UnixNano()
+
+		id, err := s.sessionID(tx, ref)
+
+		switch {
+		case err == sql.ErrNoRows && ref == "": // no session is active, so start a new one
+			if id, err = s.insert(tx, "", now); err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		}
+
+		return s.append(tx, id, now, transaction, string(data))
+	})
+}
+
+// insert creates a new active session, with the specified parent, and returns its row id
+func (s sqliteStore) insert(tx *sql.Tx, parent string, now int64) (int64, error) {
+	uid := make([]byte, 4)
+	_, _ = rand.Read(uid)
+
+	rs, err := tx.Exec(`INSERT INTO sessions (uid, parent, created, updated, active) VALUES (?, NULLIF(?, ''), ?, ?, 1)`, hex.EncodeToString(uid), parent, now, now)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return rs.LastInsertId()
+}
+
+// append adds the transaction, and its encoded data, to the session with the specified row id
+func (s sqliteStore) append(tx *sql.Tx, id, now int64, transaction gemini.Transaction, data string) error {
+	if _, err := tx.Exec(`INSERT INTO transactions (session_id, seq, created, prompt, response, data)
+		VALUES (?, (SELECT COALESCE(MAX(seq), 0) + 1 FROM transactions WHERE session_id = ?), ?, ?, ?, ?)`,
+		id, id, now, transaction.Input.Text, transaction.Output.Text, data); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(`UPDATE sessions SET updated = ? WHERE id = ?`, now, id)
+
+	return err
+}
+
+// appendAll adds the transactions to the session with the specified row id
+func (s sqliteStore) appendAll(tx *sql.Tx, id, now int64, transactions []gemini.Transaction) error {
+	for _, t := range transactions {
+		data, err := json.Marshal(t)
+
+		if err != nil {
+			return fmt.Errorf("unable to encode session transaction. %w", err)
+		}
+
+		if err := s.append(tx, id, now, t, string(data)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s sqliteStore) Undo(ref string) ([]gemini.Transaction, error) {
+	return s.replaceLastTurn(ref, nil)
+}
+
+func (s sqliteStore) Replace(ref string, transaction gemini.Transaction) error {
+	_, err := s.replaceLastTurn(ref, []gemini.Transaction{transaction})
+	return err
+}
+
+// replaceLastTurn replaces the last turn of the referenced session with the specified transactions, in a single database transaction,
+// returning the transactions removed
+func (s sqliteStore) replaceLastTurn(ref string, replacement []gemini.Transaction) ([]gemini.Transaction, error) {
+	var removed []gemini.Transaction
+
+	err := s.update(func(tx *sql.Tx) error {
+		id, err := s.sessionID(tx, ref)
+
+		switch {
+		case err == sql.ErrNoRows && ref == "":
+			return fmt.Errorf("no session is active")
+		case err != nil:
+			return err
+		}
+
+		transactions, err := queryTransactions(tx, `SELECT data FROM transactions WHERE session_id = ? ORDER BY seq`, id)
+
+		if err != nil {
+			return err
+		}
+
+		last := LastTurn(transactions)
+
+		if last < 0 {
+			return fmt.Errorf("the session has no turns to replace")
+		}
+
+		removed = transactions[last:]
+
+		if _, err := tx.Exec(`DELETE FROM transactions WHERE session_id = ? AND seq > ?`, id, last); err != nil { // seq is 1-based
+			return err
+		}
+
+		now := time.Now().UnixNano()
+
+		if _, err := tx.Exec(`UPDATE sessions SET updated = ? WHERE id = ?`, now, id); err != nil {
+			return err
+		}
+
+		return s.appendAll(tx, id, now, replacement)
+	})
+
+	return removed, err
+}
+
+func (s sqliteStore) List() ([]Record, error) {
+	return s.list(s.db, "")
+}
+
+func (s sqliteStore) Stash() error {
+	return s.update(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE sessions SET active = 0 WHERE active = 1`)
+		return err
+	})
+}
+
+func (s sqliteStore) Restore(ref string) error {
+	return s.update(func(tx *sql.Tx) error {
+		record, err := s.record(tx, ref)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`UPDATE sessions SET active = (id = ?)`, record.key)
+
+		return err
+	})
+}
+
+func (s sqliteStore) Fork(ref string, turns int) error {
+	return s.update(func(tx *sql.Tx) error {
+		record, err := s.record(tx, ref)
+
+		if err != nil {
+			return err
+		}
+
+		transactions, err := queryTransactions(tx, `SELECT data FROM transactions WHERE session_id = ? ORDER BY seq`, record.key)
+
+		if err != nil {
+			return err
+		}
+
+		if transactions, err = truncateTurns(transactions, turns); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(`UPDATE sessions SET active = 0 WHERE active = 1`); err != nil {
+			return err
+		}
+
+		now := time.Now().UnixNano()
+		id, err := s.insert(tx, record.ID, now)
+
+		if err != nil {
+			return err
+		}
+
+		return s.appendAll(tx, id, now, transactions)
+	})
+}
+
+func (s sqliteStore) Create(transactions []gemini.Transaction, name string) error {
+	return s.update(func(tx *sql.Tx) error {
+		if name != "" {
+			records, err := s.list(tx, "")
+
+			if err != nil {
+				return err
+			}
+
+			if err := checkName(records, Record{}, name); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.Exec(`UPDATE sessions SET active = 0 WHERE active = 1`); err != nil {
+			return err
+		}
+
+		now := time.Now().UnixNano()
+		id, err := s.insert(tx, "", now)
+
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(`UPDATE sessions SET name = NULLIF(?, '') WHERE id = ?`, name, id); err != nil {
+			return err
+		}
+
+		return s.appendAll(tx, id, now, transactions)
+	})
+}
+
+func (s sqliteStore) Rename(ref, name string) error {
+	return s.update(func(tx *sql.Tx) error {
+		records, err := s.list(tx, "")
+
+		if err != nil {
+			return err
+		}
+
+		record, err := findRecord(records, ref)
+
+		if err != nil {
+			return err
+		}
+
+		if err := checkName(records, record, name); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`UPDATE sessions SET name = ? WHERE id = ?`, name, record.key)
+
+		return err
+	})
+}
+
+// Delete removes the session in a single transaction. the uris of its files are collected within the transaction, but only passed to
+// deleteFiles once it has committed, so the database is not locked for writes while the files are deleted from remote storage
+func (s sqliteStore) Delete(ref string, deleteFiles DeleteFilesFunc) error {
+	var uris []string
+
+	if err := s.update(func(tx *sql.Tx) error {
+		record, err := s.record(tx, ref)
+
+		if err != nil {
+			return err
+		}
+
+		if deleteFiles != nil {
+			if uris, err = s.fileURIs(tx, `SELECT data FROM transactions WHERE session_id = ?`, record.key); err != nil {
+				return err
+			}
+
+			retained, err := s.fileURIs(tx, `SELECT data FROM transactions WHERE session_id != ?`, record.key)
+
+			if err != nil {
+				return err
+			}
+
+			uris = slices.DeleteFunc(uris, func(uri string) bool { return slices.Contains(retained, uri) })
+		}
+
+		if _, err := tx.Exec(`DELETE FROM transactions WHERE session_id = ?`, record.key); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`DELETE FROM sessions WHERE id = ?`, record.key)
+
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if deleteFiles != nil {
+		if err := deleteFiles(uris); err != nil {
+			return fmt.Errorf("unable to delete files referenced by session. %w", err)
+		}
+	}
+
+	return nil
+}
+
+// DeleteAll removes all sessions, passing the uris of their files to deleteFiles once the deletion has committed, as with Delete
+func (s sqliteStore) DeleteAll(deleteFiles DeleteFilesFunc) error {
+	var uris []string
+
+	if err := s.update(func(tx *sql.Tx) error {
+		if deleteFiles != nil {
+			var err error
+
+			if uris, err = s.fileURIs(tx, `SELECT data FROM transactions`); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.Exec(`DELETE FROM transactions`); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(`DELETE FROM sessions`)
+
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if deleteFiles != nil {
+		if err := deleteFiles(uris); err != nil {
+			return fmt.Errorf("unable to delete files referenced by sessions. %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (s sqliteStore) FileURIs() ([]string, error) {
+	return s.fileURIs(s.db, `SELECT data FROM transactions`)
+}
+
+func (s sqliteStore) Search(query string) ([]Record, error) {
+	return s.list(s.db, query)
+}
+
+func (s sqliteStore) Close() error {
+	return s.db.Close()
+}
+
+// list returns the records of all sessions, ordered by the time they were last updated. where a query is specified, only the records of
+// sessions with a prompt or response that contains it are returned, retaining the ids they have when all sessions are listed
+func (s sqliteStore) list(q querier, query string) ([]Record, error) {
+	rows, err := q.Query(`SELECT s.id, s.uid, COALESCE(s.name, ''), COALESCE(s.parent, ''), s.updated, s.active,
+			COALESCE((SELECT prompt FROM transactions t WHERE t.session_id = s.id ORDER BY seq LIMIT 1), ''),
+			EXISTS (SELECT 1 FROM transactions t WHERE t.session_id = s.id AND (t.prompt LIKE ?1 ESCAPE '\' OR t.response LIKE ?1 ESCAPE '\'))
+		FROM sessions s ORDER BY s.updated, s.id`, "%"+likeEscaper.Replace(query)+"%")
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to list sessions. %w", err)
+	}
+
+	defer rows.Close()
+
+	records := []Record{}
+
+	for i := 1; rows.Next(); i++ {
+		var (
+			id, updated               int64
+			active, match             bool
+			uid, name, parent, prompt string
+		)
+
+		if err := rows.Scan(&id, &uid, &name, &parent, &updated, &active, &prompt, &match); err != nil {
+			return nil, fmt.Errorf("unable to read session record. %w", err)
+		}
+
+		if query != "" && !match {
+			continue
+		}
+
+		records = append(records, Record{
+			ID:        uid,
+			Index:     i,
+			Name:      name,
+			Parent:    parent,
+			Summary:   summary(prompt),
+			TimeStamp: time.Unix(0, updated),
+			Active:    active,
+			key:       strconv.FormatInt(id, 10),
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("unable to list sessions. %w", err)
+	}
+
+	return records, nil
+}
+
+// record returns the record of the referenced session
+func (s sqliteStore) record(q querier, ref string) (Record, error) {
+	records, err := s.list(q, "")
+
+	if err != nil {
+		return Record{}, err
+	}
+
+	return findRecord(records, ref)
+}
+
+// sessionID returns the row id of the referenced session. sql.ErrNoRows is returned where the reference is empty and no session is active
+func (s sqliteStore) sessionID(q querier, ref string) (int64, error) {
+	if ref == "" {
+		var id int64
+		err := q.QueryRow(`SELECT id FROM sessions WHERE active = 1`).Scan(&id)
+		return id, err
+	}
+
+	record, err := s.record(q, ref)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(record.key, 10, 64)
+}
+
+func (s sqliteStore) fileURIs(q querier, query string, args ...any) ([]string, error) {
+	transactions, err := queryTransactions(q, query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return appendFileURIs([]string{}, transactions), nil
+}
+
+// update runs the func in a database transaction, which is committed where the func does not return an error
+func (s sqliteStore) update(f func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		return fmt.Errorf("unable to begin session database transaction. %w", err)
+	}
+
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("unable to update session database. %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("unable to commit session database transaction. %w", err)
+	}
+
+	return nil
+}
+
+// queryTransactions returns the transactions selected by the query, which must select only the data column
+func queryTransactions(q querier, query string, args ...any) ([]gemini.Transaction, error) {
+	rows, err := q.Query(query, args...)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to read session transactions. %w", err)
+	}
+
+	defer rows.Close()
+
+	transactions := []gemini.Transaction{}
+
+	for rows.Next() {
+		var data string
+
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("unable to read session transaction. %w", err)
+		}
+
+		transaction := gemini.Transaction{}
+
+		if err := json.Unmarshal([]byte(data), &transaction); err != nil {
+			return nil, fmt.Errorf("unable to decode session transaction. %w", err)
+		}
+
+		transactions = append(transactions, transaction)
+	}
+
+	return transactions, rows.Err()
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
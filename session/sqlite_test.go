@@ -0,0 +1,17 @@
+package session_test
+
+import (
+	"testing"
+
+	"github.com/comradequinn/gen/session"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	store, err := session.Open(session.StoreTypeSQLite, t.TempDir())
+
+	if err != nil {
+		t.Fatalf("expected no error opening store. got %v", err)
+	}
+
+	testStore(t, store)
+}
@@ -0,0 +1,123 @@
+package session
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/comradequinn/gen/gemini"
+)
+
+type (
+	// Store persists conversation sessions. one session is active at a time, to which transactions are appended by default. sessions are
+	// identified by references, being a session's id, its name or its index, as defined by Find. an empty reference identifies the active session
+	Store interface {
+		// Read returns the transactions in the referenced session
+		Read(ref string) ([]gemini.Transaction, error)
+		// Append adds the transaction to the referenced session. where the reference is empty and no session is active, a new session is started
+		Append(ref string, transaction gemini.Transaction) error
+		// Undo removes the last turn, being its prompt and any function calls and summaries that followed it, from the referenced session.
+		// the removed transactions are returned
+		Undo(ref string) ([]gemini.Transaction, error)
+		// Replace removes the last turn from the referenced session, as Undo, and appends the transaction in its place as a single update
+		Replace(ref string, transaction gemini.Transaction) error
+		// List returns the records of all sessions, including the active one, in the order they were last updated
+		List() ([]Record, error)
+		// Stash saves the active session, so the next transaction appended to the active session starts a new one
+		Stash() error
+		// Create writes the transactions to a new active session, given the name where one is specified. the active session is only stashed
+		// once the new session has been written in full
+		Create(transactions []gemini.Transaction, name string) error
+		// Restore sets the referenced session as the active session, stashing the current one
+		Restore(ref string) error
+		// Fork copies the referenced session into a new active session, recording the copied session as its parent. where turns is greater than
+		// zero, only that number of turns are copied from the start of the session
+		Fork(ref string, turns int) error
+		// Rename gives the specified name to the referenced session. names must be valid, as defined by ValidateName, and unique
+		Rename(ref, name string) error
+		// Delete removes the referenced session. where deleteFiles is specified, it is passed the uris of the uploaded files referenced
+		// by the session that are not also referenced by another session
+		Delete(ref string, deleteFiles DeleteFilesFunc) error
+		// DeleteAll removes all sessions. where deleteFiles is specified, it is passed the uris of all uploaded files they reference
+		DeleteAll(deleteFiles DeleteFilesFunc) error
+		// FileURIs returns the uris of the uploaded files referenced by all sessions
+		FileURIs() ([]string, error)
+		// Search returns the records of the sessions with a prompt or response that contains the query, ignoring case
+		Search(query string) ([]Record, error)
+		// Close releases any resources held by the store
+		Close() error
+	}
+	// fileStore stores each session as a file in the session directory of the app directory. the file names encode the time the session
+	// was created and any name given to it, and the active session is identified by the ActiveSessionFileSuffix
+	fileStore struct {
+		appDir string
+	}
+)
+
+const (
+	StoreTypeFile   = "file"
+	StoreTypeSQLite = "sqlite"
+	// SQLiteFileName is the name of the sqlite database file, within the app directory, used by the sqlite store
+	SQLiteFileName = "sessions.db"
+)
+
+// Open returns the store of the specified type, holding its data in the app directory. an empty type selects the file store
+func Open(storeType, appDir string) (Store, error) {
+	switch storeType {
+	case "", StoreTypeFile:
+		return NewFileStore(appDir), nil
+	case StoreTypeSQLite:
+		if err := os.MkdirAll(appDir, 0755); err != nil {
+			return nil, fmt.Errorf("unable to create app directory. %w", err)
+		}
+
+		return NewSQLiteStore(path.Join(appDir, SQLiteFileName))
+	default:
+		return nil, fmt.Errorf("invalid session store type '%v'. the supported types are '%v' and '%v'", storeType, StoreTypeFile, StoreTypeSQLite)
+	}
+}
+
+// NewFileStore returns a store that holds each session as a file in the session directory of the app directory
+func NewFileStore(appDir string) Store {
+	return fileStore{appDir: appDir}
+}
+
+func (s fileStore) Read(ref string) ([]gemini.Transaction, error) { return Read(s.appDir, ref) }
+
+func (s fileStore) Append(ref string, transaction gemini.Transaction) error {
+	return Write(s.appDir, ref, transaction)
+}
+
+func (s fileStore) Undo(ref string) ([]gemini.Transaction, error) { return Undo(s.appDir, ref) }
+
+func (s fileStore) Replace(ref string, transaction gemini.Transaction) error {
+	return Replace(s.appDir, ref, transaction)
+}
+
+func (s fileStore) List() ([]Record, error) { return List(s.appDir) }
+
+func (s fileStore) Stash() error { return Stash(s.appDir) }
+
+func (s fileStore) Create(transactions []gemini.Transaction, name string) error {
+	return Create(s.appDir, transactions, name)
+}
+
+func (s fileStore) Restore(ref string) error { return Restore(s.appDir, ref) }
+
+func (s fileStore) Fork(ref string, turns int) error { return Fork(s.appDir, ref, turns) }
+
+func (s fileStore) Rename(ref, name string) error { return Rename(s.appDir, ref, name) }
+
+func (s fileStore) Delete(ref string, deleteFiles DeleteFilesFunc) error {
+	return Delete(s.appDir, ref, deleteFiles)
+}
+
+func (s fileStore) DeleteAll(deleteFiles DeleteFilesFunc) error {
+	return DeleteAll(s.appDir, deleteFiles)
+}
+
+func (s fileStore) FileURIs() ([]string, error) { return FileURIs(s.appDir) }
+
+func (s fileStore) Search(query string) ([]Record, error) { return Search(s.appDir, query) }
+
+func (s fileStore) Close() error { return nil }
@@ -0,0 +1,242 @@
+package session_test
+
+import (
+	"testing"
+
+	"github.com/comradequinn/gen/gemini"
+	"github.com/comradequinn/gen/session"
+)
+
+func TestFileStore(t *testing.T) {
+	testStore(t, session.NewFileStore(t.TempDir()))
+}
+
+func TestOpenInvalidStore(t *testing.T) {
+	if _, err := session.Open("invalid", t.TempDir()); err == nil {
+		t.Fatalf("expected an error opening an invalid store type")
+	}
+}
+
+// testStore verifies the behaviour common to all store implementations
+func testStore(t *testing.T, store session.Store) {
+	defer store.Close()
+
+	appendTransaction := func(prompt, response string, uris ...string) {
+		refs := []gemini.FileReference{}
+
+		for _, uri := range uris {
+			refs = append(refs, gemini.FileReference{URI: uri})
+		}
+
+		if err := store.Append("", gemini.Transaction{Input: gemini.Input{Text: prompt, FileReferences: refs}, Output: gemini.Output{Text: response}}); err != nil {
+			t.Fatalf("expected no error appending to session. got %v", err)
+		}
+	}
+
+	assertRecords := func(records []session.Record, err error, expected ...string) {
+		t.Helper()
+
+		if err != nil {
+			t.Fatalf("expected no error listing sessions. got %v", err)
+		}
+
+		if len(records) != len(expected) {
+			t.Fatalf("expected %v records. got %+v", len(expected), records)
+		}
+
+		for i, r := range records {
+			if r.Summary != expected[i] {
+				t.Fatalf("expected record %v to have summary %q. got %+v", i, expected[i], r)
+			}
+		}
+	}
+
+	appendTransaction("weather in london", "it is raining", "test-uri-1")
+	appendTransaction("and tomorrow?", "it will be sunny")
+
+	transactions, err := store.Read("")
+
+	if err != nil || len(transactions) != 2 || transactions[1].Output.Text != "it will be sunny" {
+		t.Fatalf("expected both transactions to be read in order. got %+v, %v", transactions, err)
+	}
+
+	if err := store.Stash(); err != nil {
+		t.Fatalf("expected no error stashing session. got %v", err)
+	}
+
+	if transactions, err = store.Read(""); err != nil || len(transactions) != 0 {
+		t.Fatalf("expected no active session after stashing. got %+v, %v", transactions, err)
+	}
+
+	appendTransaction("latest go version", "go 1.24 is the latest version", "test-uri-1", "test-uri-2")
+
+	records, err := store.List()
+	assertRecords(records, err, "weather in london", "latest go version")
+
+	if records[0].Active || !records[1].Active || records[0].Index != 1 || records[1].Index != 2 {
+		t.Fatalf("expected latest session to be active with sequential ids. got %+v", records)
+	}
+
+	matches, err := store.Search("SUNNY")
+	assertRecords(matches, err, "weather in london")
+
+	if err := store.Rename("2", "golang"); err != nil {
+		t.Fatalf("expected no error naming session. got %v", err)
+	}
+
+	if err := store.Rename("1", "golang"); err == nil {
+		t.Fatalf("expected an error giving a session a name already in use")
+	}
+
+	if err := store.Rename("1", "1st"); err == nil {
+		t.Fatalf("expected an error giving a session an invalid name")
+	}
+
+	if err := store.Append("golang", gemini.Transaction{Input: gemini.Input{Text: "and the next?"}}); err != nil {
+		t.Fatalf("expected no error appending to named session. got %v", err)
+	}
+
+	if transactions, err = store.Read(records[0].ID); err != nil || len(transactions) != 2 || transactions[0].Input.Text != "weather in london" {
+		t.Fatalf("expected session to be read by id. got %+v, %v", transactions, err)
+	}
+
+	if transactions, err = store.Read("golang"); err != nil || len(transactions) != 2 || transactions[1].Input.Text != "and the next?" {
+		t.Fatalf("expected session to be read by name. got %+v, %v", transactions, err)
+	}
+
+	if records, err = store.List(); err != nil || records[1].Name != "golang" || !records[1].Active {
+		t.Fatalf("expected named session to remain active. got %+v, %v", records, err)
+	}
+
+	if _, err := store.Read("unknown"); err == nil {
+		t.Fatalf("expected an error reading a session that does not exist")
+	}
+
+	if err := store.Restore(records[0].ID); err != nil {
+		t.Fatalf("expected no error restoring session. got %v", err)
+	}
+
+	if transactions, err = store.Read(""); err != nil || len(transactions) != 2 || transactions[0].Input.Text != "weather in london" {
+		t.Fatalf("expected restored session to be active. got %+v, %v", transactions, err)
+	}
+
+	uris, err := store.FileURIs()
+
+	if err != nil || len(uris) != 2 {
+		t.Fatalf("expected the distinct uris referenced by all sessions. got %v, %v", uris, err)
+	}
+
+	if err := store.Fork("", 1); err != nil {
+		t.Fatalf("expected no error forking session. got %v", err)
+	}
+
+	if transactions, err = store.Read(""); err != nil || len(transactions) != 1 || transactions[0].Input.Text != "weather in london" {
+		t.Fatalf("expected fork truncated at the first turn to be active. got %+v, %v", transactions, err)
+	}
+
+	forks, err := store.List()
+	assertRecords(forks, err, "weather in london", "latest go version", "weather in london")
+
+	if !forks[2].Active || forks[2].Parent != records[0].ID || forks[2].ID == records[0].ID {
+		t.Fatalf("expected fork to be active with the forked session as its parent. got %+v", forks)
+	}
+
+	if transactions, err = store.Read(records[0].ID); err != nil || len(transactions) != 2 {
+		t.Fatalf("expected forked session to be unchanged. got %+v, %v", transactions, err)
+	}
+
+	if err := store.Fork("", 2); err == nil {
+		t.Fatalf("expected an error forking a session at a turn it does not have")
+	}
+
+	if err := store.Delete(forks[2].ID, nil); err != nil {
+		t.Fatalf("expected no error deleting fork. got %v", err)
+	}
+
+	if err := store.Restore(records[0].ID); err != nil {
+		t.Fatalf("expected no error restoring session. got %v", err)
+	}
+
+	records, err = store.List()
+	assertRecords(records, err, "weather in london", "latest go version")
+
+	deleted := []string{}
+	deleteFiles := func(uris []string) error {
+		deleted = append(deleted, uris...)
+		return nil
+	}
+
+	if err := store.Delete("2", deleteFiles); err != nil {
+		t.Fatalf("expected no error deleting session. got %v", err)
+	}
+
+	if len(deleted) != 1 || deleted[0] != "test-uri-2" {
+		t.Fatalf("expected only the file not referenced by another session to be deleted. got %v", deleted)
+	}
+
+	records, err = store.List()
+	assertRecords(records, err, "weather in london")
+
+	if err := store.Delete("2", nil); err == nil {
+		t.Fatalf("expected an error deleting a session that does not exist")
+	}
+
+	appendTransaction("list the files", "")
+
+	if err := store.Append("", gemini.Transaction{Input: gemini.Input{Type: gemini.InputTypeFunction}, Output: gemini.Output{Text: "there are no files"}}); err != nil {
+		t.Fatalf("expected no error appending to session. got %v", err)
+	}
+
+	removed, err := store.Undo("")
+
+	if err != nil || len(removed) != 2 || removed[0].Input.Text != "list the files" {
+		t.Fatalf("expected the last turn and its function result to be removed. got %+v, %v", removed, err)
+	}
+
+	if transactions, err = store.Read(""); err != nil || len(transactions) != 2 || transactions[1].Input.Text != "and tomorrow?" {
+		t.Fatalf("expected earlier turns to remain after undo. got %+v, %v", transactions, err)
+	}
+
+	if err := store.Replace("", gemini.Transaction{Input: gemini.Input{Text: "and the day after?"}, Output: gemini.Output{Text: "it will be cloudy"}}); err != nil {
+		t.Fatalf("expected no error replacing last turn. got %v", err)
+	}
+
+	if transactions, err = store.Read(""); err != nil || len(transactions) != 2 || transactions[1].Input.Text != "and the day after?" {
+		t.Fatalf("expected the last turn to be replaced. got %+v, %v", transactions, err)
+	}
+
+	for range 2 {
+		if _, err := store.Undo(""); err != nil {
+			t.Fatalf("expected no error undoing turn. got %v", err)
+		}
+	}
+
+	if _, err := store.Undo(""); err == nil {
+		t.Fatalf("expected an error undoing a turn in an empty session")
+	}
+
+	imported := []gemini.Transaction{{Input: gemini.Input{Text: "imported prompt"}, Output: gemini.Output{Text: "imported response"}}}
+
+	if err := store.Create(imported, "imported"); err != nil {
+		t.Fatalf("expected no error creating session. got %v", err)
+	}
+
+	if records, err = store.List(); err != nil || len(records) != 2 || !records[1].Active || records[1].Name != "imported" {
+		t.Fatalf("expected created session to be named and active. got %+v, %v", records, err)
+	}
+
+	if err := store.Create(imported, "imported"); err == nil {
+		t.Fatalf("expected an error creating a session with a name already in use")
+	}
+
+	if transactions, err = store.Read(""); err != nil || len(transactions) != 1 || transactions[0].Input.Text != "imported prompt" {
+		t.Fatalf("expected a failed create to leave the active session unchanged. got %+v, %v", transactions, err)
+	}
+
+	if err := store.DeleteAll(nil); err != nil {
+		t.Fatalf("expected no error deleting all sessions. got %v", err)
+	}
+
+	records, err = store.List()
+	assertRecords(records, err)
+}
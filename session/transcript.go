@@ -0,0 +1,232 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/comradequinn/gen/gemini"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	TranscriptFormatJSON     = "json"
+	TranscriptFormatMarkdown = "markdown"
+	TranscriptFormatYAML     = "yaml"
+)
+
+const (
+	roleUser  = "user"
+	roleModel = "model"
+)
+
+type (
+	// Transcript defines the json form of a session, as exported and imported
+	Transcript struct {
+		ID           string               `json:"id"`
+		Name         string               `json:"name,omitempty"`
+		Updated      time.Time            `json:"updated"`
+		Transactions []gemini.Transaction `json:"transactions"`
+	}
+	// Turn defines a single turn of a dialogue. a dialogue is a simpler form of transcript, such as one written by hand, consisting only of
+	// alternating user and model turns
+	Turn struct {
+		Role  string   `yaml:"role"`
+		Text  string   `yaml:"text"`
+		Files []string `yaml:"files"`
+	}
+	// ResolveFileFunc returns a reference to the file at the path, for the file to be attached to an imported user turn
+	ResolveFileFunc func(path string) (gemini.FileReference, error)
+)
+
+var (
+	turnHeading = regexp.MustCompile(`(?i)^#{1,6}\s+(user|model|gemini)\s*$`)
+	filesLabel  = regexp.MustCompile(`(?i)^\*\*files attached\*\*$`)
+	listItem    = regexp.MustCompile("^[-*]\\s+`?([^`]+)`?$")
+)
+
+// ParseTranscript returns the transactions of the transcript, in the specified format. a json transcript is in the form exported by gen,
+// whereas markdown and yaml transcripts hold a dialogue of alternating user and model turns. in markdown, each turn starts with a heading
+// of 'user' or 'model' and files are listed under a '**files attached**' label. the files of a dialogue are attached using resolveFile.
+// an error is returned where the transcript is not valid
+func ParseTranscript(data []byte, format string, resolveFile ResolveFileFunc) ([]gemini.Transaction, error) {
+	var (
+		turns []Turn
+		err   error
+	)
+
+	switch format {
+	case TranscriptFormatJSON:
+		transcript := Transcript{}
+
+		if err := json.Unmarshal(data, &transcript); err != nil {
+			return nil, fmt.Errorf("unable to decode json transcript. %w", err)
+		}
+
+		if err := validateTransactions(transcript.Transactions); err != nil {
+			return nil, err
+		}
+
+		return transcript.Transactions, nil
+	case TranscriptFormatYAML:
+		if err := yaml.Unmarshal(data, &turns); err != nil {
+			return nil, fmt.Errorf("unable to decode yaml transcript. expected a list of turns with a role, text and optional files. %w", err)
+		}
+	case TranscriptFormatMarkdown:
+		if turns, err = parseMarkdownDialogue(data); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported transcript format '%v'", format)
+	}
+
+	return dialogueTransactions(turns, resolveFile)
+}
+
+// parseMarkdownDialogue returns the turns of the markdown dialogue. any content before the first turn, such as a title, is ignored
+func parseMarkdownDialogue(data []byte) ([]Turn, error) {
+	turns, fence, files := []Turn{}, "", false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case fence != "": // within a code block, so headings and lists are part of the text
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+		case strings.HasPrefix(trimmed, "```"):
+			fence = trimmed[:len(trimmed)-len(strings.TrimLeft(trimmed, "`"))]
+		case turnHeading.MatchString(trimmed):
+			role := strings.ToLower(turnHeading.FindStringSubmatch(trimmed)[1])
+
+			if role == "gemini" {
+				role = roleModel
+			}
+
+			turns, files = append(turns, Turn{Role: role}), false
+			continue
+		case len(turns) == 0:
+			continue
+		case filesLabel.MatchString(trimmed):
+			files = true
+			continue
+		case files && listItem.MatchString(trimmed):
+			turns[len(turns)-1].Files = append(turns[len(turns)-1].Files, listItem.FindStringSubmatch(trimmed)[1])
+			continue
+		case files && trimmed == "":
+			continue
+		}
+
+		if len(turns) > 0 {
+			files = false
+			turns[len(turns)-1].Text += line + "\n"
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read markdown transcript. %w", err)
+	}
+
+	return turns, nil
+}
+
+// dialogueTransactions returns a transaction for each pair of user and model turns in the dialogue
+func dialogueTransactions(turns []Turn, resolveFile ResolveFileFunc) ([]gemini.Transaction, error) {
+	if len(turns) == 0 {
+		return nil, fmt.Errorf("invalid transcript. no turns found")
+	}
+
+	transactions := []gemini.Transaction{}
+
+	for i, turn := range turns {
+		expected := roleUser
+
+		if i%2 == 1 {
+			expected = roleModel
+		}
+
+		turn.Text = strings.TrimSpace(turn.Text)
+
+		switch {
+		case turn.Role != expected:
+			return nil, fmt.Errorf("invalid transcript. turn %v has the role '%v'. turns must alternate between '%v' and '%v', starting with '%v'", i+1, turn.Role, roleUser, roleModel, roleUser)
+		case turn.Role == roleModel && len(turn.Files) > 0:
+			return nil, fmt.Errorf("invalid transcript. turn %v has files. files can only be attached to '%v' turns", i+1, roleUser)
+		case turn.Text == "" && len(turn.Files) == 0:
+			return nil, fmt.Errorf("invalid transcript. turn %v has no text", i+1)
+		case turn.Role == roleModel && turn.Text == "":
+			return nil, fmt.Errorf("invalid transcript. turn %v has no text", i+1)
+		}
+
+		if turn.Role == roleModel {
+			transactions[len(transactions)-1].Output.Text = turn.Text
+			continue
+		}
+
+		input := gemini.Input{Type: gemini.InputTypeUser, Text: turn.Text}
+
+		for _, f := range turn.Files {
+			ref, err := resolveFile(f)
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid transcript. unable to attach file '%v' to turn %v. %w", f, i+1, err)
+			}
+
+			input.FileReferences = append(input.FileReferences, ref)
+		}
+
+		transactions = append(transactions, gemini.Transaction{Input: input})
+	}
+
+	if len(turns)%2 == 1 {
+		return nil, fmt.Errorf("invalid transcript. the final '%v' turn has no '%v' turn in response", roleUser, roleModel)
+	}
+
+	return transactions, nil
+}
+
+// validateTransactions returns an error where the transactions do not form a valid session. each function call must be followed by its
+// result, and each function result must follow a function call
+func validateTransactions(transactions []gemini.Transaction) error {
+	if len(transactions) == 0 {
+		return fmt.Errorf("invalid transcript. no transactions found")
+	}
+
+	called := false // whether the previous transaction, other than any summary, called a function
+
+	for i, t := range transactions {
+		switch {
+		case t.Input.IsSummary():
+			if t.Summarises < 0 || t.Summarises > i {
+				return fmt.Errorf("invalid transcript. transaction %v summarises %v transactions, but follows %v", i+1, t.Summarises, i)
+			}
+
+			continue
+		case t.Input.Type != gemini.InputTypeUser && t.Input.Type != gemini.InputTypeFunction:
+			return fmt.Errorf("invalid transcript. transaction %v has the unsupported input type '%v'", i+1, t.Input.Type)
+		case called && t.Input.Type != gemini.InputTypeFunction:
+			return fmt.Errorf("invalid transcript. transaction %v does not hold the result of the function called by the transaction before it", i+1)
+		case !called && t.Input.Type == gemini.InputTypeFunction:
+			return fmt.Errorf("invalid transcript. transaction %v holds a function result, but no function was called by the transaction before it", i+1)
+		case t.Output.Text == "" && !t.Output.IsFunction() && t.Input.Type != gemini.InputTypeFunction: // a cancelled function result has no output
+			return fmt.Errorf("invalid transcript. transaction %v has no output", i+1)
+		}
+
+		called = t.Output.IsFunction()
+	}
+
+	if called {
+		return fmt.Errorf("invalid transcript. the function called by the final transaction has no result")
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package session_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/comradequinn/gen/gemini"
+	"github.com/comradequinn/gen/session"
+)
+
+func TestParseTranscript(t *testing.T) {
+	resolveFile := func(path string) (gemini.FileReference, error) {
+		return gemini.FileReference{Label: path, MIMEType: "text/plain", Data: []byte("test-data")}, nil
+	}
+
+	exported, _ := json.Marshal(session.Transcript{ID: "test-id", Transactions: []gemini.Transaction{
+		{Input: gemini.Input{Type: gemini.InputTypeUser, Text: "list the files"}, Output: gemini.Output{ExecuteRequest: gemini.ExecuteRequest{Text: "ls"}}},
+		{Input: gemini.Input{Type: gemini.InputTypeFunction, ExecuteResult: gemini.ExecuteResult{Executed: true, Stdout: "a.txt"}}, Output: gemini.Output{Text: "there is one file"}},
+	}})
+
+	unanswered, _ := json.Marshal(session.Transcript{ID: "test-id", Transactions: []gemini.Transaction{
+		{Input: gemini.Input{Type: gemini.InputTypeUser, Text: "list the files"}, Output: gemini.Output{ExecuteRequest: gemini.ExecuteRequest{Text: "ls"}}},
+	}})
+
+	tests := []struct {
+		name, format, transcript string
+		expected                 []gemini.Transaction
+		expectedErr              string
+	}{
+		{
+			name:       "json",
+			format:     session.TranscriptFormatJSON,
+			transcript: string(exported),
+			expected: []gemini.Transaction{
+				{Input: gemini.Input{Type: gemini.InputTypeUser, Text: "list the files"}, Output: gemini.Output{ExecuteRequest: gemini.ExecuteRequest{Text: "ls"}}},
+				{Input: gemini.Input{Type: gemini.InputTypeFunction, ExecuteResult: gemini.ExecuteResult{Executed: true, Stdout: "a.txt"}}, Output: gemini.Output{Text: "there is one file"}},
+			},
+		},
+		{
+			name:        "json with unanswered function call",
+			format:      session.TranscriptFormatJSON,
+			transcript:  string(unanswered),
+			expectedErr: "has no result",
+		},
+		{
+			name:   "markdown",
+			format: session.TranscriptFormatMarkdown,
+			transcript: "# few-shot example\n\n## user\n\nsummarise this\n\n**files attached**\n\n- `notes.txt`\n\n## model\n\nthe notes describe:\n\n```md\n## user\n```\n\n" +
+				"## User\n\nthanks\n\n## gemini\n\nyou're welcome\n",
+			expected: []gemini.Transaction{
+				{Input: gemini.Input{Type: gemini.InputTypeUser, Text: "summarise this", FileReferences: []gemini.FileReference{{Label: "notes.txt", MIMEType: "text/plain", Data: []byte("test-data")}}}, Output: gemini.Output{Text: "the notes describe:\n\n```md\n## user\n```"}},
+				{Input: gemini.Input{Type: gemini.InputTypeUser, Text: "thanks"}, Output: gemini.Output{Text: "you're welcome"}},
+			},
+		},
+		{
+			name:        "markdown with consecutive user turns",
+			format:      session.TranscriptFormatMarkdown,
+			transcript:  "## user\n\nhello\n\n## user\n\nhello again\n",
+			expectedErr: "turns must alternate",
+		},
+		{
+			name:        "markdown with no turns",
+			format:      session.TranscriptFormatMarkdown,
+			transcript:  "# title\n\nsome text\n",
+			expectedErr: "no turns found",
+		},
+		{
+			name:       "yaml",
+			format:     session.TranscriptFormatYAML,
+			transcript: "- role: user\n  text: what is in this file?\n  files: [data.csv]\n- role: model\n  text: sales figures\n",
+			expected: []gemini.Transaction{
+				{Input: gemini.Input{Type: gemini.InputTypeUser, Text: "what is in this file?", FileReferences: []gemini.FileReference{{Label: "data.csv", MIMEType: "text/plain", Data: []byte("test-data")}}}, Output: gemini.Output{Text: "sales figures"}},
+			},
+		},
+		{
+			name:        "yaml with unanswered user turn",
+			format:      session.TranscriptFormatYAML,
+			transcript:  "- role: user\n  text: hello\n",
+			expectedErr: "has no 'model' turn in response",
+		},
+		{
+			name:        "yaml with files in a model turn",
+			format:      session.TranscriptFormatYAML,
+			transcript:  "- role: user\n  text: hello\n- role: model\n  text: hi\n  files: [data.csv]\n",
+			expectedErr: "files can only be attached to 'user' turns",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transactions, err := session.ParseTranscript([]byte(test.transcript), test.format, resolveFile)
+
+			if test.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+					t.Fatalf("expected error containing %q. got %v", test.expectedErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error. got %v", err)
+			}
+
+			actual, _ := json.Marshal(transactions)
+			expected, _ := json.Marshal(test.expected)
+
+			if string(actual) != string(expected) {
+				t.Fatalf("expected transactions %s. got %s", expected, actual)
+			}
+		})
+	}
+}